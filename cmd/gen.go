@@ -2,6 +2,12 @@ package cmd
 
 import (
 	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/Samet-MohamedAmin/gotmpl/pkg/config"
 	"github.com/Samet-MohamedAmin/gotmpl/pkg/template"
@@ -16,6 +22,14 @@ var (
 	clean        bool
 	multiple     bool
 	configPath   string
+	strict       bool
+	envPrefixes  []string
+	now          string
+	perDocument  bool
+	valueSources []template.ValueSource
+	showData     string
+	env          string
+	identity     string
 )
 
 var genCmd = &cobra.Command{
@@ -23,17 +37,37 @@ var genCmd = &cobra.Command{
 	Short: "Generate output from templates",
 	Long: `Generate files from templates in the specified directory.
 Template files should be in the source directory with extension .go.tmpl
-Data files should be in the source directory with extension .yaml`,
+Data files should be in the source directory with extension .yaml, .yml, .json, .toml, .csv or .env`,
 	Args: cobra.ExactArgs(1),
 	RunE: func(cmd *cobra.Command, args []string) error {
 		sourceDir = args[0]
-		return RunGen(sourceDir, outputDir, templateName, separate, clean, multiple, configPath)
+		return runWithOptions(genOptions(sourceDir))
 	},
 }
 
-// RunGen wraps the existing Run logic for use with cobra
+// genOptions collects the gen command flags into CLIOptions
+func genOptions(srcDir string) *CLIOptions {
+	return &CLIOptions{
+		SourceDir:    srcDir,
+		OutputDir:    outputDir,
+		TemplateName: templateName,
+		Separate:     separate,
+		Clean:        clean,
+		Multiple:     multiple,
+		ConfigPath:   configPath,
+		Strict:       strict,
+		EnvPrefixes:  envPrefixes,
+		Now:          now,
+		PerDocument:  perDocument,
+		Values:       valueSources,
+		ShowData:     showData,
+		Env:          env,
+		Identity:     identity,
+	}
+}
+
+// RunGen runs gen with the basic options; every other option keeps its default
 func RunGen(srcDir, outDir, tmplName string, sep, cln, mult bool, cfgPath string) error {
-	// Create options struct to match what the existing Run function expects
 	opts := &CLIOptions{
 		SourceDir:    srcDir,
 		OutputDir:    outDir,
@@ -44,13 +78,11 @@ func RunGen(srcDir, outDir, tmplName string, sep, cln, mult bool, cfgPath string
 		ConfigPath:   cfgPath,
 	}
 
-	// Initialize and run using existing functionality
 	return runWithOptions(opts)
 }
 
-// Extract the core logic from Run() function to be reusable with cobra
+// runWithOptions runs the gen command with the given options
 func runWithOptions(opts *CLIOptions) error {
-	// This function contains the logic from Run() but accepts the options directly
 	// Initialize configuration with the provided config path
 	if err := config.Initialize(opts.ConfigPath); err != nil {
 		return fmt.Errorf("failed to initialize configuration: %v", err)
@@ -59,10 +91,40 @@ func runWithOptions(opts *CLIOptions) error {
 	// Set the output directory in config
 	config.OutputDir = opts.OutputDir
 
+	// Strict mode turns missing keys into errors regardless of the config file
+	if opts.Strict {
+		config.MissingKey = config.MissingKeyError
+	}
+
+	// Each prefix allows the environment variables starting with it
+	for _, prefix := range opts.EnvPrefixes {
+		config.EnvAllowlist = append(config.EnvAllowlist, prefix+"*")
+	}
+
+	// Encrypted values are decrypted with the identity file of --identity or GOTMPL_IDENTITY
+	config.Identity = resolveIdentity(opts.Identity)
+
+	// Pin the clock so every template of the run sees the same instant
+	now, err := resolveNow(opts.Now)
+	if err != nil {
+		return err
+	}
+
+	// The data shown by --show-data goes to stdout, so progress messages go to stderr
+	progress := os.Stdout
+	if opts.ShowData != "" {
+		progress = os.Stderr
+	}
+	template.SetLogOutput(progress)
+
 	var templateFiles []string
-	var err error
 
 	if !opts.Multiple {
+		// Templates are only named in multiple directory mode
+		if opts.ShowData != "" && opts.ShowData != "." {
+			return fmt.Errorf("--show-data %s: templates are named in --multiple mode only; use --show-data . for the template of %s",
+				opts.ShowData, opts.SourceDir)
+		}
 		// Single directory mode: look for template.go.tmpl and data.yaml in src dir
 		templateFiles, err = validateSingleDirectoryMode(opts.SourceDir)
 		if err != nil {
@@ -70,13 +132,46 @@ func runWithOptions(opts *CLIOptions) error {
 		}
 	} else {
 		// Multiple directory mode: use the finder to locate templates
+		templateName := opts.TemplateName
+		if opts.ShowData != "" {
+			templateName = opts.ShowData
+		}
 		finder := template.NewFinder(opts.SourceDir)
-		templateFiles, err = finder.FindTemplates(opts.TemplateName)
+		templateFiles, err = finder.FindTemplates(templateName)
 		if err != nil {
 			return err
 		}
 	}
 
+	processor := template.NewProcessor(opts.Separate)
+	processor.SetSourceRoot(opts.SourceDir)
+	processor.SetNow(now)
+	processor.SetPerDocument(opts.PerDocument)
+	defer processor.Close()
+
+	// Values files and --set assignments are read once and merged over every template's data
+	if err := processor.LoadValues(opts.Values); err != nil {
+		return err
+	}
+
+	environments, err := resolveEnvironments(progress, processor, opts.Env, templateFiles, opts.Multiple)
+	if err != nil {
+		return err
+	}
+
+	// Show the merged data instead of generating files
+	if opts.ShowData != "" {
+		for _, env := range environments {
+			processor.SetEnvironment(env)
+			for _, templatePath := range templateFiles {
+				if err := processor.ShowData(os.Stdout, templatePath, opts.Multiple); err != nil {
+					return err
+				}
+			}
+		}
+		return processor.Close()
+	}
+
 	// Clean the output directory after validation but before generation
 	if opts.Clean {
 		if err := cleanOutputDir(opts.OutputDir); err != nil {
@@ -84,17 +179,106 @@ func runWithOptions(opts *CLIOptions) error {
 		}
 	}
 
-	// Process all templates
-	processor := template.NewProcessor(opts.Separate)
-	for _, templatePath := range templateFiles {
-		if err := processor.ProcessTemplate(templatePath, opts.Multiple); err != nil {
-			return err
+	// Process all templates, once per environment. With --env all each environment is
+	// rendered into its own subdirectory of the output directory.
+	for _, env := range environments {
+		processor.SetEnvironment(env)
+		if opts.Env == template.AllEnvironments {
+			config.OutputDir = filepath.Join(opts.OutputDir, env)
+		}
+		for _, templatePath := range templateFiles {
+			if err := processor.ProcessTemplate(templatePath, opts.Multiple); err != nil {
+				return err
+			}
+		}
+	}
+
+	// Plugins that fail on shutdown are reported too
+	return processor.Close()
+}
+
+// resolveEnvironments returns the environments to render: none when --env is not set,
+// every overlay found next to the templates' data for "all", and the named one otherwise,
+// provided at least one template has an overlay for it
+func resolveEnvironments(progress io.Writer, processor *template.TemplateProcessor, env string, templateFiles []string, multiple bool) ([]string, error) {
+	if env == "" {
+		return []string{""}, nil
+	}
+	if env != template.AllEnvironments {
+		if err := template.ValidEnvironment(env); err != nil {
+			return nil, fmt.Errorf("invalid --env: %w", err)
 		}
+		if err := processor.CheckEnvironment(env, templateFiles, multiple); err != nil {
+			return nil, fmt.Errorf("--env %s: %w", env, err)
+		}
+		return []string{env}, nil
 	}
 
+	environments, err := processor.Environments(templateFiles, multiple)
+	if err != nil {
+		return nil, err
+	}
+	if len(environments) == 0 {
+		return nil, fmt.Errorf("--env all: no environment overlays found next to the data files")
+	}
+	fmt.Fprintf(progress, "Environments: %s\n", strings.Join(environments, ", "))
+	return environments, nil
+}
+
+// valueSourceFlag is a repeatable values flag. Every values flag appends to the same list,
+// so values files and assignments keep their command line order.
+type valueSourceFlag struct {
+	flag    string
+	sources *[]template.ValueSource
+}
+
+func (f *valueSourceFlag) String() string {
+	var values []string
+	for _, source := range *f.sources {
+		if source.Flag == f.flag {
+			values = append(values, source.Value)
+		}
+	}
+	if len(values) == 0 {
+		return ""
+	}
+	return "[" + strings.Join(values, ",") + "]"
+}
+
+func (f *valueSourceFlag) Set(value string) error {
+	*f.sources = append(*f.sources, template.ValueSource{Flag: f.flag, Value: value})
 	return nil
 }
 
+func (f *valueSourceFlag) Type() string {
+	return "stringArray"
+}
+
+// resolveNow returns the instant templates see as the current time: the --now value,
+// then the SOURCE_DATE_EPOCH environment variable, then the actual current time
+func resolveNow(value string) (time.Time, error) {
+	if value != "" {
+		if seconds, err := strconv.ParseInt(value, 10, 64); err == nil {
+			return time.Unix(seconds, 0).UTC(), nil
+		}
+		t, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid --now value %q: expected Unix seconds or an RFC 3339 time", value)
+		}
+		return t, nil
+	}
+
+	if epoch := os.Getenv("SOURCE_DATE_EPOCH"); epoch != "" {
+		seconds, err := strconv.ParseInt(epoch, 10, 64)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid SOURCE_DATE_EPOCH %q: expected Unix seconds", epoch)
+		}
+		return time.Unix(seconds, 0).UTC(), nil
+	}
+
+	return time.Now(), nil
+}
+
 func init() {
 	rootCmd.AddCommand(genCmd)
 
@@ -105,4 +289,15 @@ func init() {
 	genCmd.Flags().StringVarP(&configPath, "config", "f", "config.yaml", "Path to the configuration file")
 	genCmd.Flags().StringVarP(&outputDir, "output", "o", "output", "Output directory for generated files")
 	genCmd.Flags().BoolVarP(&multiple, "multiple", "m", false, "Process multiple template directories")
+	genCmd.Flags().StringSliceVar(&envPrefixes, "env-prefix", nil, "Allow templates to read environment variables starting with this prefix (repeatable)")
+	genCmd.Flags().StringVar(&now, "now", "", "Pin the time seen by templates (Unix seconds or RFC 3339, overrides SOURCE_DATE_EPOCH)")
+	genCmd.Flags().VarP(&valueSourceFlag{template.ValuesFlag, &valueSources}, "values", "v", "Values file merged over the data of every template (repeatable, later values win)")
+	genCmd.Flags().Var(&valueSourceFlag{template.SetFlag, &valueSources}, "set", "Set a value merged over the data, e.g. image.tag=1.2.3 (repeatable, comma-separated)")
+	genCmd.Flags().Var(&valueSourceFlag{template.SetStringFlag, &valueSources}, "set-string", "Like --set but always sets a string")
+	genCmd.Flags().Var(&valueSourceFlag{template.SetFileFlag, &valueSources}, "set-file", "Like --set but sets the content of the named file")
+	genCmd.Flags().StringVar(&env, "env", "", "Merge the data.<env> overlay over each data file (use all to render every environment into output/<env>)")
+	genCmd.Flags().StringVarP(&identity, "identity", "i", "", "Age identity file decrypting !encrypted data values (default $"+identityEnv+")")
+	genCmd.Flags().BoolVar(&perDocument, "per-document", false, "Render each template once per document of a multi-document data file (same as foreach-doc=true)")
+	genCmd.Flags().StringVar(&showData, "show-data", "", "Print the data of a template (. in single directory mode) after inheritance and overrides as YAML instead of generating files")
+	genCmd.Flags().BoolVar(&strict, "strict", false, "Fail when a template uses a key missing from the data (same as MissingKey: error)")
 }
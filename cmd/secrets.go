@@ -0,0 +1,107 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/Samet-MohamedAmin/gotmpl/pkg/config"
+	"github.com/Samet-MohamedAmin/gotmpl/pkg/template"
+	"github.com/spf13/cobra"
+)
+
+// identityEnv names the environment variable holding the identity file used when
+// --identity is not set
+const identityEnv = "GOTMPL_IDENTITY"
+
+// encryptedPrefix is the YAML tag marking encrypted data values
+const encryptedPrefix = "!encrypted "
+
+var (
+	recipients     []string
+	secretIdentity string
+)
+
+var encryptCmd = &cobra.Command{
+	Use:   "encrypt [value]",
+	Short: "Encrypt a value for a data file",
+	Long: `Encrypt a value with age X25519 keys and print it tagged !encrypted, ready to be
+pasted into a YAML data file:
+
+  password: !encrypted YWdlLWVuY3J5cHRpb24ub3JnL3Yx...
+
+The value is read from standard input when it is not given as an argument; a single
+trailing newline is removed. Without --recipient, the value is encrypted for the
+identities of the --identity file (default $GOTMPL_IDENTITY).`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		config.Identity = resolveIdentity(secretIdentity)
+		value, err := secretInput(cmd, args)
+		if err != nil {
+			return err
+		}
+
+		encrypted, err := template.EncryptValue([]byte(value), recipients)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(cmd.OutOrStdout(), encryptedPrefix+encrypted)
+		return nil
+	},
+}
+
+var decryptCmd = &cobra.Command{
+	Use:   "decrypt [value]",
+	Short: "Decrypt a value of a data file",
+	Long: `Decrypt an !encrypted value of a data file with the identities of the --identity file
+(default $GOTMPL_IDENTITY) and print it. The value is read from standard input when it is
+not given as an argument, with or without its !encrypted tag.`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		config.Identity = resolveIdentity(secretIdentity)
+		value, err := secretInput(cmd, args)
+		if err != nil {
+			return err
+		}
+
+		value = strings.TrimPrefix(strings.TrimSpace(value), strings.TrimSpace(encryptedPrefix))
+		decrypted, err := template.DecryptValue(value)
+		if err != nil {
+			return err
+		}
+		fmt.Fprint(cmd.OutOrStdout(), decrypted)
+		return nil
+	},
+}
+
+// resolveIdentity returns the identity file: the flag value, then the GOTMPL_IDENTITY
+// environment variable
+func resolveIdentity(flagValue string) string {
+	if flagValue != "" {
+		return flagValue
+	}
+	return os.Getenv(identityEnv)
+}
+
+// secretInput returns the value given as argument, or read from standard input
+func secretInput(cmd *cobra.Command, args []string) (string, error) {
+	if len(args) == 1 {
+		return args[0], nil
+	}
+	content, err := io.ReadAll(cmd.InOrStdin())
+	if err != nil {
+		return "", fmt.Errorf("failed to read value: %w", err)
+	}
+	return strings.TrimSuffix(strings.TrimSuffix(string(content), "\n"), "\r"), nil
+}
+
+func init() {
+	rootCmd.AddCommand(encryptCmd)
+	rootCmd.AddCommand(decryptCmd)
+
+	encryptCmd.Flags().StringArrayVarP(&recipients, "recipient", "r", nil, "Age X25519 recipient (age1...) to encrypt for (repeatable)")
+	for _, c := range []*cobra.Command{encryptCmd, decryptCmd} {
+		c.Flags().StringVarP(&secretIdentity, "identity", "i", "", "Age identity file (default $"+identityEnv+")")
+	}
+}
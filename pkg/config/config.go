@@ -3,7 +3,9 @@ package config
 import (
 	"fmt"
 	"os"
+	"path"
 	"path/filepath"
+	"regexp"
 	"sync"
 
 	"gopkg.in/yaml.v3"
@@ -15,6 +17,32 @@ const Version = "v0.1.2"
 // AllTemplates represents a wildcard for template selection
 const AllTemplates = "ALL"
 
+// Missing key behaviors, mapped onto the text/template missingkey option
+const (
+	// MissingKeyDefault prints "<no value>" for missing keys
+	MissingKeyDefault = "default"
+	// MissingKeyZero renders the zero value for missing keys
+	MissingKeyZero = "zero"
+	// MissingKeyError stops execution with an error on missing keys
+	MissingKeyError = "error"
+)
+
+// Key orders of data maps when templates range over them
+const (
+	// DataOrderSorted ranges over map keys in alphabetical order, as Go templates do
+	DataOrderSorted = "sorted"
+	// DataOrderPreserve ranges over map keys in the order of the data files
+	DataOrderPreserve = "preserve"
+)
+
+// Template engines
+const (
+	// EngineText renders templates with text/template, without any escaping
+	EngineText = "text"
+	// EngineHTML renders templates with html/template and contextual escaping
+	EngineHTML = "html"
+)
+
 // AppConfig manages the application configuration
 type AppConfig struct {
 	// Directories
@@ -25,6 +53,31 @@ type AppConfig struct {
 	TemplateFile    string `yaml:"TemplateFile"`
 	DataFile        string `yaml:"DataFile"`
 	DefaultPrefix   string `yaml:"DefaultPrefix"`
+	PartialsDir     string `yaml:"PartialsDir"`
+
+	// Rendering
+	Engine     string `yaml:"Engine"`
+	MissingKey string `yaml:"MissingKey"`
+	LeftDelim  string `yaml:"LeftDelim"`
+	RightDelim string `yaml:"RightDelim"`
+	DataOrder  string `yaml:"DataOrder"`
+
+	// Environment variables readable by templates, as glob patterns
+	EnvAllowlist []string `yaml:"EnvAllowlist"`
+
+	// External executables providing template functions
+	Plugins []Plugin `yaml:"Plugins"`
+
+	// Template functions declared as template bodies, by name
+	Functions map[string]string `yaml:"Functions"`
+}
+
+// Plugin declares an executable that provides template functions
+type Plugin struct {
+	// Name identifies the plugin in messages; it defaults to the command
+	Name    string   `yaml:"Name"`
+	Command string   `yaml:"Command"`
+	Args    []string `yaml:"Args"`
 }
 
 // Default configuration values
@@ -34,8 +87,20 @@ var defaultConfig = AppConfig{
 	TemplateFile:    "template.go.tmpl",
 	DataFile:        "data.yaml",
 	DefaultPrefix:   "file",
+	PartialsDir:     "",
+	Engine:          EngineText,
+	MissingKey:      MissingKeyDefault,
+	LeftDelim:       "{{",
+	RightDelim:      "}}",
+	DataOrder:       DataOrderSorted,
+	EnvAllowlist:    nil,
+	Plugins:         nil,
+	Functions:       nil,
 }
 
+// functionName matches the names Go templates accept for functions
+var functionName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
 // Global instance
 var (
 	instance *AppConfig
@@ -49,8 +114,22 @@ var (
 	TemplateFile    = defaultConfig.TemplateFile
 	DataFile        = defaultConfig.DataFile
 	DefaultPrefix   = defaultConfig.DefaultPrefix
+	PartialsDir     = defaultConfig.PartialsDir
+	Engine          = defaultConfig.Engine
+	MissingKey      = defaultConfig.MissingKey
+	LeftDelim       = defaultConfig.LeftDelim
+	RightDelim      = defaultConfig.RightDelim
+	DataOrder       = defaultConfig.DataOrder
+	EnvAllowlist    = defaultConfig.EnvAllowlist
+	Plugins         = defaultConfig.Plugins
+	Functions       = defaultConfig.Functions
 )
 
+// Identity is the path of the age identity file that decrypts !encrypted data values. It is
+// set from the command line or the environment rather than the config file, so the path
+// to a private key isn't shared through the repository.
+var Identity string
+
 // GetConfig returns the singleton config instance
 func GetConfig() *AppConfig {
 	once.Do(func() {
@@ -95,11 +174,66 @@ func Initialize(configPath string) error {
 		if fileConfig.DefaultPrefix != "" {
 			config.DefaultPrefix = fileConfig.DefaultPrefix
 		}
+		if fileConfig.PartialsDir != "" {
+			config.PartialsDir = fileConfig.PartialsDir
+		}
+		if fileConfig.Engine != "" {
+			config.Engine = fileConfig.Engine
+		}
+		if fileConfig.MissingKey != "" {
+			config.MissingKey = fileConfig.MissingKey
+		}
+		if fileConfig.LeftDelim != "" || fileConfig.RightDelim != "" {
+			if fileConfig.LeftDelim == "" || fileConfig.RightDelim == "" {
+				return fmt.Errorf("LeftDelim and RightDelim must be set together")
+			}
+			config.LeftDelim = fileConfig.LeftDelim
+			config.RightDelim = fileConfig.RightDelim
+		}
+		if fileConfig.DataOrder != "" {
+			config.DataOrder = fileConfig.DataOrder
+		}
+		if len(fileConfig.EnvAllowlist) > 0 {
+			config.EnvAllowlist = fileConfig.EnvAllowlist
+		}
+		if len(fileConfig.Plugins) > 0 {
+			config.Plugins = fileConfig.Plugins
+		}
+		if len(fileConfig.Functions) > 0 {
+			config.Functions = fileConfig.Functions
+		}
 	} else if !os.IsNotExist(err) {
 		// If there's an error other than "file not exists"
 		return fmt.Errorf("error checking config file: %w", err)
 	}
 
+	// Validate values that can't be checked by the decoder
+	if config.Engine != EngineText && config.Engine != EngineHTML {
+		return fmt.Errorf("invalid Engine %q: expected %q or %q", config.Engine, EngineText, EngineHTML)
+	}
+	if !ValidMissingKey(config.MissingKey) {
+		return fmt.Errorf("invalid MissingKey %q: expected %q, %q or %q",
+			config.MissingKey, MissingKeyDefault, MissingKeyZero, MissingKeyError)
+	}
+	if config.DataOrder != DataOrderSorted && config.DataOrder != DataOrderPreserve {
+		return fmt.Errorf("invalid DataOrder %q: expected %q or %q", config.DataOrder, DataOrderSorted, DataOrderPreserve)
+	}
+	for _, pattern := range config.EnvAllowlist {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid EnvAllowlist pattern %q: %w", pattern, err)
+		}
+	}
+	for i, plugin := range config.Plugins {
+		if plugin.Command == "" {
+			return fmt.Errorf("plugin %d has no Command", i+1)
+		}
+	}
+	for name := range config.Functions {
+		if !ValidFunctionName(name) {
+			return fmt.Errorf("invalid function name %q in Functions", name)
+		}
+	}
+
 	// Create output directory if it doesn't exist
 	if err := ensureDirectory(config.OutputDir); err != nil {
 		return fmt.Errorf("failed to create output directory: %w", err)
@@ -116,10 +250,29 @@ func Initialize(configPath string) error {
 	TemplateFile = config.TemplateFile
 	DataFile = config.DataFile
 	DefaultPrefix = config.DefaultPrefix
+	PartialsDir = config.PartialsDir
+	Engine = config.Engine
+	MissingKey = config.MissingKey
+	LeftDelim = config.LeftDelim
+	RightDelim = config.RightDelim
+	DataOrder = config.DataOrder
+	EnvAllowlist = config.EnvAllowlist
+	Plugins = config.Plugins
+	Functions = config.Functions
 
 	return nil
 }
 
+// ValidFunctionName reports whether name is accepted by Go templates as a function name
+func ValidFunctionName(name string) bool {
+	return functionName.MatchString(name)
+}
+
+// ValidMissingKey reports whether value is a supported MissingKey behavior
+func ValidMissingKey(value string) bool {
+	return value == MissingKeyDefault || value == MissingKeyZero || value == MissingKeyError
+}
+
 // ensureDirectory creates a directory if it doesn't exist
 func ensureDirectory(dir string) error {
 	if _, err := os.Stat(dir); os.IsNotExist(err) {
@@ -146,5 +299,15 @@ func Reset() {
 	TemplateFile = defaultConfig.TemplateFile
 	DataFile = defaultConfig.DataFile
 	DefaultPrefix = defaultConfig.DefaultPrefix
+	PartialsDir = defaultConfig.PartialsDir
+	Engine = defaultConfig.Engine
+	MissingKey = defaultConfig.MissingKey
+	LeftDelim = defaultConfig.LeftDelim
+	RightDelim = defaultConfig.RightDelim
+	DataOrder = defaultConfig.DataOrder
+	EnvAllowlist = defaultConfig.EnvAllowlist
+	Plugins = defaultConfig.Plugins
+	Functions = defaultConfig.Functions
+	Identity = ""
 	instance = nil
 }
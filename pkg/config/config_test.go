@@ -85,6 +85,24 @@ func TestInitializeWithNonExistentFile(t *testing.T) {
 	if DefaultPrefix != defaultConfig.DefaultPrefix {
 		t.Errorf("Expected default DefaultPrefix, got %s", DefaultPrefix)
 	}
+	if Engine != EngineText {
+		t.Errorf("Expected default Engine to be '%s', got %s", EngineText, Engine)
+	}
+}
+
+func TestInitializeWithInvalidEngine(t *testing.T) {
+	tempDir := t.TempDir()
+	configPath := filepath.Join(tempDir, "config.yaml")
+	configContent := "OutputDir: \"" + filepath.Join(tempDir, "output") + "\"\nEngine: \"xml\"\n"
+	if err := os.WriteFile(configPath, []byte(configContent), 0644); err != nil {
+		t.Fatalf("Failed to write test config file: %v", err)
+	}
+
+	Reset()
+
+	if err := Initialize(configPath); err == nil {
+		t.Error("Expected Initialize to fail for an unsupported engine")
+	}
 }
 
 func TestGetOutputPath(t *testing.T) {
@@ -136,3 +154,81 @@ func TestGetOutputPath(t *testing.T) {
 		})
 	}
 }
+
+func TestInitializeWithDelims(t *testing.T) {
+	tempDir := t.TempDir()
+	outputDir := filepath.Join(tempDir, "output")
+
+	testCases := []struct {
+		name      string
+		content   string
+		expectErr bool
+	}{
+		{"Both delimiters", "LeftDelim: \"[[\"\nRightDelim: \"]]\"\n", false},
+		{"Only left delimiter", "LeftDelim: \"[[\"\n", true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			configPath := filepath.Join(tempDir, "config.yaml")
+			content := "OutputDir: \"" + outputDir + "\"\n" + tc.content
+			if err := os.WriteFile(configPath, []byte(content), 0644); err != nil {
+				t.Fatalf("Failed to write test config file: %v", err)
+			}
+
+			Reset()
+			err := Initialize(configPath)
+			if tc.expectErr {
+				if err == nil {
+					t.Error("Expected Initialize to fail")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Initialize failed: %v", err)
+			}
+			if LeftDelim != "[[" || RightDelim != "]]" {
+				t.Errorf("Expected delimiters [[ and ]], got %s and %s", LeftDelim, RightDelim)
+			}
+		})
+	}
+}
+
+func TestInitializeWithFunctions(t *testing.T) {
+	tempDir := t.TempDir()
+	outputDir := filepath.Join(tempDir, "output")
+
+	testCases := []struct {
+		name      string
+		content   string
+		expectErr bool
+	}{
+		{"Valid function", "Functions:\n  fqdn: \"{{ .name }}.svc\"\n", false},
+		{"Invalid function name", "Functions:\n  my-func: \"x\"\n", true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			configPath := filepath.Join(tempDir, "config.yaml")
+			content := "OutputDir: \"" + outputDir + "\"\n" + tc.content
+			if err := os.WriteFile(configPath, []byte(content), 0644); err != nil {
+				t.Fatalf("Failed to write test config file: %v", err)
+			}
+
+			Reset()
+			err := Initialize(configPath)
+			if tc.expectErr {
+				if err == nil {
+					t.Error("Expected Initialize to fail")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Initialize failed: %v", err)
+			}
+			if Functions["fqdn"] != "{{ .name }}.svc" {
+				t.Errorf("Expected function fqdn to be loaded, got %v", Functions)
+			}
+		})
+	}
+}
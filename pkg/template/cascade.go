@@ -0,0 +1,155 @@
+package template
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// inheritedData returns the data inherited by a template in multiple mode: the data files of
+// the source root and of every directory between it and the template directory, each with
+// its environment overlay, merged from root to leaf. It returns nil when no ancestor has a
+// data file.
+func (p *TemplateProcessor) inheritedData(templatePath string, multiple bool) (map[string]interface{}, error) {
+	dirs, err := p.templateAncestors(templatePath, multiple)
+	if err != nil {
+		return nil, err
+	}
+
+	var inherited map[string]interface{}
+	for _, dir := range dirs {
+		dataPath, err := FindDataFile(dir)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+
+		var layers []map[string]interface{}
+		if err == nil {
+			logf("Inheriting data file: %s\n", dataPath)
+			data, err := p.loadData(dataPath)
+			if err != nil {
+				return nil, fmt.Errorf("failed to load inherited data: %w", err)
+			}
+			switch values := data.(type) {
+			case nil:
+			case map[string]interface{}:
+				layers = append(layers, values)
+			default:
+				return nil, fmt.Errorf("inherited data file %s is not a mapping", dataPath)
+			}
+		}
+
+		overlay, err := p.loadOverlay(dir)
+		if err != nil {
+			return nil, err
+		}
+		if overlay != nil {
+			layers = append(layers, overlay)
+		}
+
+		for _, layer := range layers {
+			if inherited == nil {
+				inherited = make(map[string]interface{})
+			}
+			mergeValues(inherited, layer)
+		}
+	}
+	return inherited, nil
+}
+
+// templateAncestors returns the directories a template inherits data from in multiple mode:
+// the source root and every directory between it and the template directory
+func (p *TemplateProcessor) templateAncestors(templatePath string, multiple bool) ([]string, error) {
+	if !multiple || p.sourceRoot == "" {
+		return nil, nil
+	}
+
+	root, err := filepath.Abs(p.sourceRoot)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get absolute path for source root: %w", err)
+	}
+	templateDir, err := filepath.Abs(filepath.Dir(templatePath))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get absolute path for template directory: %w", err)
+	}
+	if !isWithin(root, templateDir) {
+		return nil, nil
+	}
+	return ancestorDirs(root, templateDir), nil
+}
+
+// ancestorDirs returns root and the directories below it that contain dir, excluding dir
+// itself, from the root down
+func ancestorDirs(root, dir string) []string {
+	rel, err := filepath.Rel(root, dir)
+	if err != nil || rel == "." {
+		return nil
+	}
+
+	dirs := []string{root}
+	parts := strings.Split(rel, string(filepath.Separator))
+	current := root
+	for _, part := range parts[:len(parts)-1] {
+		current = filepath.Join(current, part)
+		dirs = append(dirs, current)
+	}
+	return dirs
+}
+
+// mergeInherited merges a data document over the inherited data
+func mergeInherited(inherited map[string]interface{}, data interface{}) (interface{}, error) {
+	if inherited == nil {
+		return data, nil
+	}
+
+	merged := copyMap(inherited)
+	switch values := data.(type) {
+	case nil:
+	case map[string]interface{}:
+		mergeValues(merged, values)
+	default:
+		return nil, fmt.Errorf("data is not a mapping")
+	}
+	return merged, nil
+}
+
+// ShowData writes the data a template is rendered with, after inheritance and value
+// overrides, as YAML. Each document starts with --- and a comment naming the template and
+// environment, so the data of several templates forms one YAML stream; documents rendered
+// separately in foreach-doc mode are numbered. Decrypted values are replaced with <redacted>
+// before the data is encoded.
+func (p *TemplateProcessor) ShowData(w io.Writer, templatePath string, multiple bool) error {
+	p.resetConfig()
+
+	// The template is loaded for its config directive, which selects foreach-doc mode
+	if _, err := p.loadTemplate(templatePath); err != nil {
+		return fmt.Errorf("failed to load template: %w", err)
+	}
+
+	documents, err := p.templateDocuments(templatePath, multiple)
+	if err != nil {
+		return err
+	}
+
+	header := "# Data for " + templatePath
+	if p.environment != "" {
+		header += fmt.Sprintf(" (environment %s)", p.environment)
+	}
+	for i, document := range documents {
+		fmt.Fprintln(w, "---")
+		if len(documents) > 1 {
+			fmt.Fprintf(w, "%s, document %d\n", header, i)
+		} else {
+			fmt.Fprintln(w, header)
+		}
+		out, err := toYAML(p.secrets.mask(document))
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(w, out)
+	}
+	return nil
+}
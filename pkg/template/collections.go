@@ -0,0 +1,537 @@
+package template
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+)
+
+// dict builds a map from alternating keys and values
+func dict(pairs ...interface{}) (map[string]interface{}, error) {
+	if len(pairs)%2 != 0 {
+		return nil, fmt.Errorf("dict: expected an even number of arguments, got %d", len(pairs))
+	}
+	result := make(map[string]interface{}, len(pairs)/2)
+	for i := 0; i < len(pairs); i += 2 {
+		setKey(result, toString(pairs[i]), pairs[i+1])
+	}
+	return result, nil
+}
+
+// list builds a list from its arguments
+func list(items ...interface{}) []interface{} {
+	return items
+}
+
+// appendList returns a copy of a list with the items added at the end
+func appendList(l interface{}, items ...interface{}) []interface{} {
+	source := toList(l)
+	result := make([]interface{}, 0, len(source)+len(items))
+	result = append(result, source...)
+	return append(result, items...)
+}
+
+// toMap converts a map with string keys to a map[string]interface{}
+func toMap(v interface{}) (map[string]interface{}, error) {
+	switch value := v.(type) {
+	case nil:
+		return map[string]interface{}{}, nil
+	case map[string]interface{}:
+		return value, nil
+	}
+
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Map || rv.Type().Key().Kind() != reflect.String {
+		return nil, fmt.Errorf("expected a map, got %T", v)
+	}
+	result := make(map[string]interface{}, rv.Len())
+	iter := rv.MapRange()
+	for iter.Next() {
+		result[iter.Key().String()] = iter.Value().Interface()
+	}
+	return result, nil
+}
+
+// copyMap returns a deep copy of a map, copying nested maps and lists as well. The copy
+// keeps the key order of the map.
+func copyMap(m map[string]interface{}) map[string]interface{} {
+	result := make(map[string]interface{}, len(m))
+	for _, key := range orderedKeys(m) {
+		setKey(result, key, copyValue(m[key]))
+	}
+	return result
+}
+
+// copyValue returns a deep copy of maps and lists and the value itself otherwise
+func copyValue(v interface{}) interface{} {
+	switch value := v.(type) {
+	case map[string]interface{}:
+		return copyMap(value)
+	case []interface{}:
+		result := make([]interface{}, len(value))
+		for i, item := range value {
+			result[i] = copyValue(item)
+		}
+		return result
+	default:
+		return v
+	}
+}
+
+// mergeInto deep-merges src into dst. Nested maps are merged; for other values dst keeps
+// its own value unless overwrite is set. Keys new to dst are added in the order of src.
+func mergeInto(dst, src map[string]interface{}, overwrite bool) {
+	for _, key := range orderedKeys(src) {
+		srcValue := src[key]
+		dstValue, exists := dst[key]
+		if !exists {
+			setKey(dst, key, copyValue(srcValue))
+			continue
+		}
+		dstMap, dstIsMap := dstValue.(map[string]interface{})
+		srcMap, srcIsMap := srcValue.(map[string]interface{})
+		if dstIsMap && srcIsMap {
+			mergeInto(dstMap, srcMap, overwrite)
+		} else if overwrite {
+			dst[key] = copyValue(srcValue)
+		}
+	}
+}
+
+// merge deep-merges maps into a new map. Values of earlier maps win.
+func merge(dst interface{}, sources ...interface{}) (map[string]interface{}, error) {
+	return mergeMaps("merge", false, dst, sources)
+}
+
+// mergeOverwrite deep-merges maps into a new map. Values of later maps win.
+func mergeOverwrite(dst interface{}, sources ...interface{}) (map[string]interface{}, error) {
+	return mergeMaps("mergeOverwrite", true, dst, sources)
+}
+
+// mergeMaps implements merge and mergeOverwrite without modifying their arguments
+func mergeMaps(name string, overwrite bool, dst interface{}, sources []interface{}) (map[string]interface{}, error) {
+	first, err := toMap(dst)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	result := copyMap(first)
+	for _, source := range sources {
+		m, err := toMap(source)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		mergeInto(result, m, overwrite)
+	}
+	return result, nil
+}
+
+// keys returns the sorted keys of one or more maps
+func keys(maps ...interface{}) ([]string, error) {
+	seen := make(map[string]bool)
+	var result []string
+	for _, v := range maps {
+		m, err := toMap(v)
+		if err != nil {
+			return nil, fmt.Errorf("keys: %w", err)
+		}
+		for key := range m {
+			if !seen[key] {
+				seen[key] = true
+				result = append(result, key)
+			}
+		}
+	}
+	sort.Strings(result)
+	return result, nil
+}
+
+// values returns the values of a map, ordered by key
+func values(v interface{}) ([]interface{}, error) {
+	m, err := toMap(v)
+	if err != nil {
+		return nil, fmt.Errorf("values: %w", err)
+	}
+	sortedKeys, _ := keys(m)
+	result := make([]interface{}, 0, len(m))
+	for _, key := range sortedKeys {
+		result = append(result, m[key])
+	}
+	return result, nil
+}
+
+// pick returns a new map with only the given keys, in the order of the map
+func pick(v interface{}, names ...string) (map[string]interface{}, error) {
+	m, err := toMap(v)
+	if err != nil {
+		return nil, fmt.Errorf("pick: %w", err)
+	}
+	picked := make(map[string]bool, len(names))
+	for _, name := range names {
+		picked[name] = true
+	}
+	result := make(map[string]interface{}, len(names))
+	for _, key := range orderedKeys(m) {
+		if picked[key] {
+			setKey(result, key, m[key])
+		}
+	}
+	return result, nil
+}
+
+// omit returns a new map without the given keys
+func omit(v interface{}, names ...string) (map[string]interface{}, error) {
+	m, err := toMap(v)
+	if err != nil {
+		return nil, fmt.Errorf("omit: %w", err)
+	}
+	excluded := make(map[string]bool, len(names))
+	for _, name := range names {
+		excluded[name] = true
+	}
+	result := make(map[string]interface{}, len(m))
+	for _, key := range orderedKeys(m) {
+		if !excluded[key] {
+			setKey(result, key, m[key])
+		}
+	}
+	return result, nil
+}
+
+// hasKey reports whether a map has a key
+func hasKey(v interface{}, key string) (bool, error) {
+	m, err := toMap(v)
+	if err != nil {
+		return false, fmt.Errorf("hasKey: %w", err)
+	}
+	_, ok := m[key]
+	return ok, nil
+}
+
+// dig follows a path of keys through nested maps and returns the default when a key is missing.
+// Usage: dig "a" "b" "c" DEFAULT MAP
+func dig(args ...interface{}) (interface{}, error) {
+	if len(args) < 3 {
+		return nil, fmt.Errorf("dig: expected at least one key, a default and a map")
+	}
+	path := args[:len(args)-2]
+	def := args[len(args)-2]
+
+	current := args[len(args)-1]
+	for _, key := range path {
+		m, err := toMap(current)
+		if err != nil {
+			return def, nil
+		}
+		value, ok := m[toString(key)]
+		if !ok {
+			return def, nil
+		}
+		current = value
+	}
+	return current, nil
+}
+
+// uniq returns the items of a list without duplicates, keeping the first occurrence
+func uniq(l interface{}) []interface{} {
+	var result []interface{}
+	for _, item := range toList(l) {
+		duplicate := false
+		for _, existing := range result {
+			if reflect.DeepEqual(existing, item) {
+				duplicate = true
+				break
+			}
+		}
+		if !duplicate {
+			result = append(result, item)
+		}
+	}
+	return result
+}
+
+// sortAlpha returns the items of a list sorted by their string form
+func sortAlpha(l interface{}) []string {
+	items := toList(l)
+	result := make([]string, len(items))
+	for i, item := range items {
+		result[i] = toString(item)
+	}
+	sort.Strings(result)
+	return result
+}
+
+// sortBy returns the maps of a list sorted by a field. Numbers are compared numerically and
+// everything else by string form; the sort is stable so equal items keep their order.
+func sortBy(field string, l interface{}) ([]interface{}, error) {
+	items := toList(l)
+	result := make([]interface{}, len(items))
+	copy(result, items)
+
+	var sortErr error
+	sort.SliceStable(result, func(i, j int) bool {
+		a, errA := fieldOf(result[i], field)
+		b, errB := fieldOf(result[j], field)
+		if errA != nil || errB != nil {
+			if sortErr == nil {
+				sortErr = firstError(errA, errB)
+			}
+			return false
+		}
+		return lessValue(a, b)
+	})
+	if sortErr != nil {
+		return nil, fmt.Errorf("sortBy: %w", sortErr)
+	}
+	return result, nil
+}
+
+// groupBy groups the maps of a list by the string form of a field, keeping their order
+func groupBy(field string, l interface{}) (map[string]interface{}, error) {
+	result := make(map[string]interface{})
+	for _, item := range toList(l) {
+		value, err := fieldOf(item, field)
+		if err != nil {
+			return nil, fmt.Errorf("groupBy: %w", err)
+		}
+		key := toString(value)
+		group, _ := result[key].([]interface{})
+		setKey(result, key, append(group, item))
+	}
+	return result, nil
+}
+
+// fieldOf returns a field of a map item
+func fieldOf(item interface{}, field string) (interface{}, error) {
+	m, err := toMap(item)
+	if err != nil {
+		return nil, err
+	}
+	return m[field], nil
+}
+
+// firstError returns the first non-nil error
+func firstError(errs ...error) error {
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// lessValue orders two values numerically when both are numbers and by string form otherwise
+func lessValue(a, b interface{}) bool {
+	if x, ok := toFloat(a); ok {
+		if y, ok := toFloat(b); ok {
+			return x < y
+		}
+	}
+	return toString(a) < toString(b)
+}
+
+// first returns the first item of a list, or nil if it is empty
+func first(l interface{}) interface{} {
+	items := toList(l)
+	if len(items) == 0 {
+		return nil
+	}
+	return items[0]
+}
+
+// last returns the last item of a list, or nil if it is empty
+func last(l interface{}) interface{} {
+	items := toList(l)
+	if len(items) == 0 {
+		return nil
+	}
+	return items[len(items)-1]
+}
+
+// rest returns all items of a list but the first
+func rest(l interface{}) []interface{} {
+	items := toList(l)
+	if len(items) == 0 {
+		return []interface{}{}
+	}
+	return items[1:]
+}
+
+// until returns the integers from 0 up to, but not including, count
+func until(count int) []int {
+	if count <= 0 {
+		return []int{}
+	}
+	result := make([]int, count)
+	for i := range result {
+		result[i] = i
+	}
+	return result
+}
+
+// seq returns the integers from start to end, both included, like the seq command:
+// seq END counts from 1, seq START END counts by 1 and seq START STEP END by STEP. Without
+// a step, the sequence counts down when end is below start.
+func seq(args ...int) ([]int, error) {
+	start, step, end := 1, 0, 0
+	switch len(args) {
+	case 1:
+		end = args[0]
+	case 2:
+		start, end = args[0], args[1]
+	case 3:
+		start, step, end = args[0], args[1], args[2]
+		if step == 0 {
+			return nil, fmt.Errorf("seq: step must not be 0")
+		}
+	default:
+		return nil, fmt.Errorf("seq: expected 1 to 3 arguments, got %d", len(args))
+	}
+	if step == 0 {
+		step = 1
+		if end < start {
+			step = -1
+		}
+	}
+
+	result := []int{}
+	for i := start; (step > 0 && i <= end) || (step < 0 && i >= end); i += step {
+		result = append(result, i)
+	}
+	return result, nil
+}
+
+// toFloat converts any numeric value or numeric string to a float64
+func toFloat(v interface{}) (float64, bool) {
+	switch value := v.(type) {
+	case string:
+		f, err := strconv.ParseFloat(value, 64)
+		return f, err == nil
+	case nil:
+		return 0, false
+	}
+
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(rv.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(rv.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return rv.Float(), true
+	default:
+		return 0, false
+	}
+}
+
+// toInt converts any numeric value or numeric string to an int64
+func toInt(v interface{}) (int64, bool) {
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return rv.Int(), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return int64(rv.Uint()), true
+	case reflect.String:
+		i, err := strconv.ParseInt(rv.String(), 10, 64)
+		return i, err == nil
+	}
+	return 0, false
+}
+
+// numbers converts the operands of an arithmetic function. The result is integral when
+// every operand is an integer and floating point otherwise.
+func numbers(name string, operands []interface{}) ([]int64, []float64, bool, error) {
+	ints := make([]int64, len(operands))
+	floats := make([]float64, len(operands))
+	integral := true
+	for i, operand := range operands {
+		f, ok := toFloat(operand)
+		if !ok {
+			return nil, nil, false, fmt.Errorf("%s: %v is not a number", name, operand)
+		}
+		floats[i] = f
+		if n, ok := toInt(operand); ok {
+			ints[i] = n
+		} else {
+			integral = false
+		}
+	}
+	return ints, floats, integral, nil
+}
+
+// arithmetic builds a variadic math function from integer and floating point implementations
+func arithmetic(name string, intOp func(a, b int64) (int64, error), floatOp func(a, b float64) (float64, error)) func(a interface{}, rest ...interface{}) (interface{}, error) {
+	return func(a interface{}, rest ...interface{}) (interface{}, error) {
+		ints, floats, integral, err := numbers(name, append([]interface{}{a}, rest...))
+		if err != nil {
+			return nil, err
+		}
+		if integral {
+			result := ints[0]
+			for _, n := range ints[1:] {
+				if result, err = intOp(result, n); err != nil {
+					return nil, fmt.Errorf("%s: %w", name, err)
+				}
+			}
+			return result, nil
+		}
+		result := floats[0]
+		for _, f := range floats[1:] {
+			if result, err = floatOp(result, f); err != nil {
+				return nil, fmt.Errorf("%s: %w", name, err)
+			}
+		}
+		return result, nil
+	}
+}
+
+// errDivisionByZero is returned by div and mod
+var errDivisionByZero = fmt.Errorf("division by zero")
+
+// The arithmetic functions accept any number of operands of any numeric type, as produced by
+// the data decoders, and fold them from left to right.
+var (
+	add = arithmetic("add",
+		func(a, b int64) (int64, error) { return a + b, nil },
+		func(a, b float64) (float64, error) { return a + b, nil })
+	sub = arithmetic("sub",
+		func(a, b int64) (int64, error) { return a - b, nil },
+		func(a, b float64) (float64, error) { return a - b, nil })
+	mul = arithmetic("mul",
+		func(a, b int64) (int64, error) { return a * b, nil },
+		func(a, b float64) (float64, error) { return a * b, nil })
+	div = arithmetic("div",
+		func(a, b int64) (int64, error) {
+			if b == 0 {
+				return 0, errDivisionByZero
+			}
+			return a / b, nil
+		},
+		func(a, b float64) (float64, error) {
+			if b == 0 {
+				return 0, errDivisionByZero
+			}
+			return a / b, nil
+		})
+	mod = arithmetic("mod",
+		func(a, b int64) (int64, error) {
+			if b == 0 {
+				return 0, errDivisionByZero
+			}
+			return a % b, nil
+		},
+		func(a, b float64) (float64, error) {
+			if b == 0 {
+				return 0, errDivisionByZero
+			}
+			return math.Mod(a, b), nil
+		})
+	maxOf = arithmetic("max",
+		func(a, b int64) (int64, error) { return max(a, b), nil },
+		func(a, b float64) (float64, error) { return math.Max(a, b), nil })
+	minOf = arithmetic("min",
+		func(a, b int64) (int64, error) { return min(a, b), nil },
+		func(a, b float64) (float64, error) { return math.Min(a, b), nil })
+)
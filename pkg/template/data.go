@@ -0,0 +1,326 @@
+package template
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/Samet-MohamedAmin/gotmpl/pkg/config"
+)
+
+// dataExtensions are the supported data file extensions, in lookup order
+var dataExtensions = []string{".yaml", ".yml", ".json", ".toml", ".csv", ".env"}
+
+// supportedDataExtension reports whether ext selects a data decoder
+func supportedDataExtension(ext string) bool {
+	for _, supported := range dataExtensions {
+		if ext == supported {
+			return true
+		}
+	}
+	return false
+}
+
+// dataFileCandidates returns the data file names looked up in a template directory. When
+// DataFile has a supported extension, the same name with any supported extension matches,
+// so "data.yaml" also finds data.json or data.toml. Other names are used as is. Each name
+// may also be a data template, with the .tmpl extension added.
+func dataFileCandidates() []string {
+	names := []string{config.DataFile}
+	if ext := filepath.Ext(config.DataFile); supportedDataExtension(ext) {
+		stem := strings.TrimSuffix(config.DataFile, ext)
+		names = make([]string, len(dataExtensions))
+		for i, candidate := range dataExtensions {
+			names[i] = stem + candidate
+		}
+	}
+
+	candidates := make([]string, 0, 2*len(names))
+	for _, name := range names {
+		candidates = append(candidates, name, name+dataTemplateExt)
+	}
+	return candidates
+}
+
+// FindDataFile returns the data file in a directory. It fails when none of the supported
+// data files exists, or when several do and the choice would be ambiguous.
+func FindDataFile(dir string) (string, error) {
+	return findOneOf(dir, "data", dataFileCandidates())
+}
+
+// findOneOf returns the only existing file of the candidates in a directory, describing them
+// as kind files in errors. The error wraps os.ErrNotExist when none exists.
+func findOneOf(dir, kind string, candidates []string) (string, error) {
+	var found []string
+	for _, name := range candidates {
+		path := filepath.Join(dir, name)
+		if info, err := os.Stat(path); err == nil && !info.IsDir() {
+			found = append(found, path)
+		} else if err != nil && !os.IsNotExist(err) {
+			return "", fmt.Errorf("failed to check %s file: %w", kind, err)
+		}
+	}
+
+	switch len(found) {
+	case 0:
+		return "", fmt.Errorf("no %s file (%s) found in %s: %w", kind, strings.Join(candidates, ", "), dir, os.ErrNotExist)
+	case 1:
+		return found[0], nil
+	default:
+		names := make([]string, len(found))
+		for i, path := range found {
+			names[i] = filepath.Base(path)
+		}
+		return "", fmt.Errorf("ambiguous %s files in %s: %s; keep only one", kind, dir, strings.Join(names, ", "))
+	}
+}
+
+// decodeDocuments decodes a data file with the decoder selected by its extension. YAML files
+// may hold several documents separated by "---", each with its custom tags resolved; other
+// formats hold exactly one. Files with an unsupported extension are decoded as YAML. The
+// files read by the custom YAML tags must be inside root, or inside the file's directory
+// when root is empty, and the values they decrypt are recorded in secrets. The key order of
+// YAML and JSON maps is recorded; TOML, CSV and dotenv data has none.
+func decodeDocuments(path string, content []byte, root string, secrets *secretSet) ([]interface{}, error) {
+	var data interface{}
+	var err error
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		data, err = decodeJSON(content)
+	case ".toml":
+		data, err = decodeTOML(content)
+	case ".csv":
+		data, err = decodeCSV(content)
+	case ".env":
+		data, err = decodeDotenv(content)
+	default:
+		nodes, _, err := parseDataNodes(path, content, root, secrets)
+		if err != nil {
+			return nil, err
+		}
+		for _, node := range nodes {
+			recordOverrides(node, "", nil)
+		}
+		return decodeNodes(nodes)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return []interface{}{data}, nil
+}
+
+// decodeJSON decodes a JSON document, recording the key order of its objects. Integral
+// numbers become ints, like in YAML data.
+func decodeJSON(content []byte) (interface{}, error) {
+	decoder := json.NewDecoder(bytes.NewReader(content))
+	decoder.UseNumber()
+
+	data, err := jsonValue(decoder)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode JSON data: %w", err)
+	}
+	if _, err := decoder.Token(); err != io.EOF {
+		return nil, fmt.Errorf("failed to decode JSON data: unexpected content after the document")
+	}
+	return data, nil
+}
+
+// jsonValue decodes the next value of a JSON stream token by token, so the keys of objects
+// are seen in order
+func jsonValue(decoder *json.Decoder) (interface{}, error) {
+	token, err := decoder.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	switch t := token.(type) {
+	case json.Delim:
+		if t == '[' {
+			list := []interface{}{}
+			for decoder.More() {
+				item, err := jsonValue(decoder)
+				if err != nil {
+					return nil, err
+				}
+				list = append(list, item)
+			}
+			_, err := decoder.Token()
+			return list, err
+		}
+
+		object := make(map[string]interface{})
+		var keys []string
+		for decoder.More() {
+			token, err := decoder.Token()
+			if err != nil {
+				return nil, err
+			}
+			key := token.(string)
+			value, err := jsonValue(decoder)
+			if err != nil {
+				return nil, err
+			}
+			if _, exists := object[key]; !exists {
+				keys = append(keys, key)
+			}
+			object[key] = value
+		}
+		setKeyOrder(object, keys)
+		_, err := decoder.Token()
+		return object, err
+	case json.Number:
+		return normalizeData(t), nil
+	default:
+		return token, nil
+	}
+}
+
+// decodeTOML decodes a TOML document
+func decodeTOML(content []byte) (interface{}, error) {
+	var data map[string]interface{}
+	if err := toml.Unmarshal(content, &data); err != nil {
+		return nil, fmt.Errorf("failed to decode TOML data: %w", err)
+	}
+	return normalizeData(data), nil
+}
+
+// decodeCSV decodes a CSV file into a list of records keyed by the header row. Values are
+// kept as strings.
+func decodeCSV(content []byte) (interface{}, error) {
+	rows, err := csv.NewReader(bytes.NewReader(content)).ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode CSV data: %w", err)
+	}
+
+	records := []interface{}{}
+	if len(rows) == 0 {
+		return records, nil
+	}
+
+	header := rows[0]
+	seen := make(map[string]bool, len(header))
+	for i, name := range header {
+		if name == "" {
+			return nil, fmt.Errorf("failed to decode CSV data: column %d has no name", i+1)
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("failed to decode CSV data: duplicate column %q", name)
+		}
+		seen[name] = true
+	}
+
+	for _, row := range rows[1:] {
+		record := make(map[string]interface{}, len(header))
+		for i, name := range header {
+			record[name] = row[i]
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+// decodeDotenv decodes KEY=VALUE lines into a map of strings. Blank lines, comments and an
+// "export " prefix are ignored. Double-quoted values support \n, \t, \" and \\ escapes;
+// single-quoted values are taken literally.
+func decodeDotenv(content []byte) (interface{}, error) {
+	data := make(map[string]interface{})
+
+	for i, line := range strings.Split(string(content), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimPrefix(line, "export ")
+
+		key, value, ok := strings.Cut(line, "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" {
+			return nil, fmt.Errorf("failed to decode dotenv data: line %d: expected KEY=VALUE", i+1)
+		}
+
+		value, err := dotenvValue(strings.TrimSpace(value))
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode dotenv data: line %d: %w", i+1, err)
+		}
+		data[key] = value
+	}
+	return data, nil
+}
+
+// dotenvValue unquotes a dotenv value and strips trailing comments from unquoted values
+func dotenvValue(value string) (string, error) {
+	switch {
+	case strings.HasPrefix(value, `"`):
+		end := closingQuote(value)
+		if end < 0 {
+			return "", errors.New("unterminated double-quoted value")
+		}
+		return strconv.Unquote(value[:end+1])
+	case strings.HasPrefix(value, "'"):
+		end := strings.IndexByte(value[1:], '\'')
+		if end < 0 {
+			return "", errors.New("unterminated single-quoted value")
+		}
+		return value[1 : end+1], nil
+	default:
+		if idx := strings.Index(value, " #"); idx >= 0 {
+			value = strings.TrimSpace(value[:idx])
+		}
+		return value, nil
+	}
+}
+
+// closingQuote returns the index of the double quote ending a quoted value, or -1
+func closingQuote(value string) int {
+	for i := 1; i < len(value); i++ {
+		switch value[i] {
+		case '\\':
+			i++
+		case '"':
+			return i
+		}
+	}
+	return -1
+}
+
+// normalizeData converts decoded values to the types produced by the YAML decoder, so
+// templates behave the same whatever the data format: integral numbers become ints and
+// every list becomes a []interface{}.
+func normalizeData(v interface{}) interface{} {
+	switch value := v.(type) {
+	case map[string]interface{}:
+		for key, item := range value {
+			value[key] = normalizeData(item)
+		}
+		return value
+	case []interface{}:
+		for i, item := range value {
+			value[i] = normalizeData(item)
+		}
+		return value
+	case []map[string]interface{}:
+		list := make([]interface{}, len(value))
+		for i, item := range value {
+			list[i] = normalizeData(item)
+		}
+		return list
+	case json.Number:
+		if n, err := value.Int64(); err == nil {
+			return int(n)
+		}
+		f, _ := value.Float64()
+		return f
+	case int64:
+		return int(value)
+	default:
+		return v
+	}
+}
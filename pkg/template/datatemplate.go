@@ -0,0 +1,64 @@
+package template
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	"github.com/Samet-MohamedAmin/gotmpl/pkg/config"
+)
+
+// dataTemplateExt is the extension of data files rendered as templates before they are
+// decoded, so data.yaml.tmpl is rendered and then decoded as YAML
+const dataTemplateExt = ".tmpl"
+
+// isDataTemplate reports whether a data file is rendered as a template before decoding
+func isDataTemplate(path string) bool {
+	return filepath.Ext(path) == dataTemplateExt
+}
+
+// renderDataTemplate renders a data template. It has the same functions as the templates,
+// with the allowed environment variables as .Env; the data itself doesn't exist yet.
+func (p *TemplateProcessor) renderDataTemplate(path string, content []byte) ([]byte, error) {
+	set := newTemplateSet()
+	funcs, err := p.funcMap(path, set)
+	if err != nil {
+		return nil, err
+	}
+
+	parsed, err := template.New(filepath.Base(path)).
+		Delims(config.LeftDelim, config.RightDelim).
+		Funcs(funcs).
+		Option("missingkey=" + config.MissingKey).
+		Parse(string(content))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse data template: %w", err)
+	}
+	set.parsed = parsed
+	set.tmpl = parsed
+	set.files[parsed.Name()] = path
+
+	var buf bytes.Buffer
+	if err := set.Execute(&buf, map[string]interface{}{envKey: envMap()}); err != nil {
+		return nil, fmt.Errorf("failed to render data template: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// decodeDataTemplate renders a data template and decodes the result with the decoder of the
+// extension before .tmpl
+func (p *TemplateProcessor) decodeDataTemplate(path string, content []byte) ([]interface{}, error) {
+	rendered, err := p.renderDataTemplate(path, content)
+	if err != nil {
+		return nil, err
+	}
+
+	renderedPath := strings.TrimSuffix(path, dataTemplateExt)
+	documents, err := decodeDocuments(renderedPath, rendered, p.rootDir(path), p.secrets)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode the output of data template %s: %w", path, err)
+	}
+	return documents, nil
+}
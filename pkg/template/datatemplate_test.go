@@ -0,0 +1,101 @@
+package template
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Samet-MohamedAmin/gotmpl/pkg/config"
+)
+
+func TestProcessTemplateDataTemplate(t *testing.T) {
+	t.Setenv("GOTMPL_TEST_REGION", "eu-west-1")
+
+	testCases := []struct {
+		name     string
+		files    map[string]string
+		expected string
+		err      string
+	}{
+		{
+			name: "Computed values",
+			files: map[string]string{
+				"app/data.yaml.tmpl": "{{ $name := \"shop\" }}name: {{ $name }}\n" +
+					"host: {{ $name }}.{{ .Env.GOTMPL_TEST_REGION }}.example.com\n" +
+					"ports:\n{{- range list 80 443 }}\n  - {{ . }}\n{{- end }}\n",
+			},
+			expected: "shop shop.eu-west-1.example.com [80 443]",
+		},
+		{
+			name: "JSON data template",
+			files: map[string]string{
+				"app/data.json.tmpl": `{"name": {{ "shop" | toJson }}, "host": "{{ env "GOTMPL_TEST_REGION" }}", "ports": [80]}`,
+			},
+			expected: "shop eu-west-1 [80]",
+		},
+		{
+			name: "Inherited data template",
+			files: map[string]string{
+				"data.yaml.tmpl": "host: {{ upper \"db\" }}\n",
+				"app/data.yaml":  "name: shop\n",
+			},
+			expected: "shop DB <no value>",
+		},
+		{
+			name: "Data file and data template",
+			files: map[string]string{
+				"app/data.yaml":      "name: shop\n",
+				"app/data.yaml.tmpl": "name: shop\n",
+			},
+			err: "ambiguous data files",
+		},
+		{
+			name:  "Render error",
+			files: map[string]string{"app/data.yaml.tmpl": "name: {{ requiredEnv \"GOTMPL_TEST_MISSING\" }}\n"},
+			err:   `failed to render data template: template: data.yaml.tmpl:1:9`,
+		},
+		{
+			name:  "Invalid output",
+			files: map[string]string{"app/data.yaml.tmpl": "name: [{{ \"shop\" }}\n"},
+			err:   "failed to decode the output of data template",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			srcDir := t.TempDir()
+			config.Reset()
+			config.OutputDir = t.TempDir()
+			config.EnvAllowlist = []string{"GOTMPL_TEST_*"}
+			defer config.Reset()
+
+			files := map[string]string{"app/template.go.tmpl": "{{ .name }} {{ .host }} {{ .ports }}"}
+			for name, content := range tc.files {
+				files[name] = content
+			}
+			writeFiles(t, srcDir, files)
+
+			processor := NewProcessor(false)
+			processor.SetSourceRoot(srcDir)
+			err := processor.ProcessTemplate(filepath.Join(srcDir, "app", config.TemplateFile), true)
+			if tc.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.err) {
+					t.Errorf("Expected error containing %q, got %v", tc.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ProcessTemplate failed: %v", err)
+			}
+
+			content, err := os.ReadFile(filepath.Join(config.OutputDir, "app", config.DefaultPrefix))
+			if err != nil {
+				t.Fatalf("Failed to read output: %v", err)
+			}
+			if strings.TrimSpace(string(content)) != tc.expected {
+				t.Errorf("Expected output %q, got %q", tc.expected, content)
+			}
+		})
+	}
+}
@@ -0,0 +1,77 @@
+package template
+
+import (
+	"fmt"
+	"text/template"
+	"time"
+)
+
+// timeFuncs returns the date and time functions. now always returns the given instant,
+// so every file rendered in one run sees the same time.
+func timeFuncs(now time.Time) template.FuncMap {
+	return template.FuncMap{
+		"now":        func() time.Time { return now },
+		"date":       formatDate,
+		"dateModify": dateModify,
+		"unixEpoch":  unixEpoch,
+		"toDate":     toDate,
+	}
+}
+
+// toTime converts a time value or Unix seconds to a time.Time
+func toTime(v interface{}) (time.Time, error) {
+	switch value := v.(type) {
+	case time.Time:
+		return value, nil
+	case *time.Time:
+		return *value, nil
+	case int:
+		return time.Unix(int64(value), 0).UTC(), nil
+	case int64:
+		return time.Unix(value, 0).UTC(), nil
+	case int32:
+		return time.Unix(int64(value), 0).UTC(), nil
+	default:
+		return time.Time{}, fmt.Errorf("expected a time or Unix seconds, got %T", v)
+	}
+}
+
+// formatDate formats a time with a Go layout such as "2006-01-02"
+func formatDate(layout string, v interface{}) (string, error) {
+	t, err := toTime(v)
+	if err != nil {
+		return "", fmt.Errorf("date: %w", err)
+	}
+	return t.Format(layout), nil
+}
+
+// dateModify adds a duration such as "+24h" or "-90m" to a time
+func dateModify(modification string, v interface{}) (time.Time, error) {
+	t, err := toTime(v)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("dateModify: %w", err)
+	}
+	duration, err := time.ParseDuration(modification)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("dateModify: %w", err)
+	}
+	return t.Add(duration), nil
+}
+
+// unixEpoch returns a time as Unix seconds
+func unixEpoch(v interface{}) (int64, error) {
+	t, err := toTime(v)
+	if err != nil {
+		return 0, fmt.Errorf("unixEpoch: %w", err)
+	}
+	return t.Unix(), nil
+}
+
+// toDate parses a string with a Go layout. Times without a zone are taken as UTC.
+func toDate(layout, value string) (time.Time, error) {
+	t, err := time.Parse(layout, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("toDate: %w", err)
+	}
+	return t, nil
+}
@@ -0,0 +1,114 @@
+package template
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"hash/adler32"
+	"strconv"
+	"strings"
+)
+
+// uuidNamespaces are the predefined name space IDs of RFC 4122, usable by name in uuidv5
+var uuidNamespaces = map[string]string{
+	"dns":  "6ba7b810-9dad-11d1-80b4-00c04fd430c8",
+	"url":  "6ba7b811-9dad-11d1-80b4-00c04fd430c8",
+	"oid":  "6ba7b812-9dad-11d1-80b4-00c04fd430c8",
+	"x500": "6ba7b814-9dad-11d1-80b4-00c04fd430c8",
+}
+
+// base64Encode encodes a string with standard base64
+func base64Encode(s string) string {
+	return base64.StdEncoding.EncodeToString([]byte(s))
+}
+
+// base64Decode decodes a standard base64 string
+func base64Decode(s string) (string, error) {
+	decoded, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return "", fmt.Errorf("base64dec: %w", err)
+	}
+	return string(decoded), nil
+}
+
+// base32Encode encodes a string with standard base32
+func base32Encode(s string) string {
+	return base32.StdEncoding.EncodeToString([]byte(s))
+}
+
+// base32Decode decodes a standard base32 string
+func base32Decode(s string) (string, error) {
+	decoded, err := base32.StdEncoding.DecodeString(s)
+	if err != nil {
+		return "", fmt.Errorf("base32dec: %w", err)
+	}
+	return string(decoded), nil
+}
+
+// hexEncode encodes a string as lower case hexadecimal
+func hexEncode(s string) string {
+	return hex.EncodeToString([]byte(s))
+}
+
+// hexDecode decodes a hexadecimal string
+func hexDecode(s string) (string, error) {
+	decoded, err := hex.DecodeString(s)
+	if err != nil {
+		return "", fmt.Errorf("hexdec: %w", err)
+	}
+	return string(decoded), nil
+}
+
+// sha1Sum returns the hex encoded SHA-1 checksum of a string
+func sha1Sum(s string) string {
+	sum := sha1.Sum([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+// sha256Sum returns the hex encoded SHA-256 checksum of a string
+func sha256Sum(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+// adler32Sum returns the Adler-32 checksum of a string as a decimal string
+func adler32Sum(s string) string {
+	return strconv.FormatUint(uint64(adler32.Checksum([]byte(s))), 10)
+}
+
+// uuidv5 returns the name based UUID (RFC 4122 version 5) for a name in a name space.
+// The name space is either a UUID or one of the predefined names dns, url, oid and x500.
+func uuidv5(namespace, name string) (string, error) {
+	if predefined, ok := uuidNamespaces[strings.ToLower(namespace)]; ok {
+		namespace = predefined
+	}
+	ns, err := parseUUID(namespace)
+	if err != nil {
+		return "", fmt.Errorf("uuidv5: %w", err)
+	}
+
+	hash := sha1.New()
+	hash.Write(ns)
+	hash.Write([]byte(name))
+	uuid := hash.Sum(nil)[:16]
+
+	uuid[6] = (uuid[6] & 0x0f) | 0x50 // version 5
+	uuid[8] = (uuid[8] & 0x3f) | 0x80 // RFC 4122 variant
+
+	return fmt.Sprintf("%x-%x-%x-%x-%x", uuid[0:4], uuid[4:6], uuid[6:8], uuid[8:10], uuid[10:16]), nil
+}
+
+// parseUUID decodes a UUID in its canonical 8-4-4-4-12 hexadecimal form
+func parseUUID(s string) ([]byte, error) {
+	if len(s) != 36 || s[8] != '-' || s[13] != '-' || s[18] != '-' || s[23] != '-' {
+		return nil, fmt.Errorf("invalid UUID %q", s)
+	}
+	decoded, err := hex.DecodeString(strings.ReplaceAll(s, "-", ""))
+	if err != nil {
+		return nil, fmt.Errorf("invalid UUID %q: %w", s, err)
+	}
+	return decoded, nil
+}
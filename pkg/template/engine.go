@@ -0,0 +1,57 @@
+package template
+
+import (
+	"fmt"
+	htmltemplate "html/template"
+	"io"
+	"text/template"
+
+	"github.com/Samet-MohamedAmin/gotmpl/pkg/config"
+)
+
+// Template is the subset of the text/template and html/template APIs used to render output
+type Template interface {
+	Execute(wr io.Writer, data interface{}) error
+	ExecuteTemplate(wr io.Writer, name string, data interface{}) error
+}
+
+// newEngineTemplate turns a parsed template set into an executable template for the given engine.
+// Parsing is always done with text/template; the html engine reuses the parse trees and adds
+// contextual escaping on top of them, so it needs the functions and options again.
+func newEngineTemplate(engine string, parsed *template.Template, funcs template.FuncMap, options ...string) (Template, error) {
+	switch engine {
+	case "", config.EngineText:
+		return parsed, nil
+	case config.EngineHTML:
+		return toHTMLTemplate(parsed, funcs, options)
+	default:
+		return nil, fmt.Errorf("unsupported template engine %q (expected %q or %q)",
+			engine, config.EngineText, config.EngineHTML)
+	}
+}
+
+// toHTMLTemplate copies every parse tree of a text template set into an html/template set
+func toHTMLTemplate(parsed *template.Template, funcs template.FuncMap, options []string) (Template, error) {
+	set := htmltemplate.New(parsed.Name()).Funcs(htmltemplate.FuncMap(funcs)).Option(options...)
+
+	for _, t := range parsed.Templates() {
+		if t.Tree == nil {
+			continue
+		}
+		if _, err := set.AddParseTree(t.Name(), t.Tree); err != nil {
+			return nil, fmt.Errorf("failed to add template %q to html set: %w", t.Name(), err)
+		}
+	}
+
+	// The root template has to be looked up again because AddParseTree returns a new handle
+	root := set.Lookup(parsed.Name())
+	if root == nil {
+		return nil, fmt.Errorf("template %q is empty", parsed.Name())
+	}
+	return root, nil
+}
+
+// validEngine reports whether name is a supported template engine
+func validEngine(name string) bool {
+	return name == config.EngineText || name == config.EngineHTML
+}
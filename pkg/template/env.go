@@ -0,0 +1,86 @@
+package template
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"strings"
+	"text/template"
+
+	"github.com/Samet-MohamedAmin/gotmpl/pkg/config"
+)
+
+// envKey is the key of the environment map added to the data root
+const envKey = "Env"
+
+// envFuncs returns the environment access functions
+func envFuncs() template.FuncMap {
+	return template.FuncMap{
+		"env":         envValue,
+		"requiredEnv": requiredEnv,
+	}
+}
+
+// envAllowed reports whether an environment variable matches a pattern of EnvAllowlist
+func envAllowed(name string) bool {
+	for _, pattern := range config.EnvAllowlist {
+		if matched, _ := path.Match(pattern, name); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// envValue returns the value of an allowed environment variable, or "" if it is not set
+func envValue(name string) (string, error) {
+	if !envAllowed(name) {
+		return "", fmt.Errorf("environment variable %q is not allowed by EnvAllowlist", name)
+	}
+	return os.Getenv(name), nil
+}
+
+// requiredEnv returns the value of an allowed environment variable, failing if it is unset or empty
+func requiredEnv(name string) (string, error) {
+	value, err := envValue(name)
+	if err != nil {
+		return "", err
+	}
+	if value == "" {
+		return "", fmt.Errorf("required environment variable %q is not set", name)
+	}
+	return value, nil
+}
+
+// envMap returns every allowed environment variable
+func envMap() map[string]interface{} {
+	env := make(map[string]interface{})
+	for _, entry := range os.Environ() {
+		name, value, _ := strings.Cut(entry, "=")
+		if envAllowed(name) {
+			env[name] = value
+		}
+	}
+	return env
+}
+
+// withEnv adds the allowed environment variables to the data root as .Env. Data is returned
+// unchanged when EnvAllowlist is empty, when it isn't a mapping, or when it defines Env itself.
+func withEnv(data interface{}) interface{} {
+	if len(config.EnvAllowlist) == 0 {
+		return data
+	}
+	if data == nil {
+		return map[string]interface{}{envKey: envMap()}
+	}
+
+	root, ok := data.(map[string]interface{})
+	if !ok {
+		return data
+	}
+	if _, exists := root[envKey]; exists {
+		logf("Warning: data defines %s, environment variables are not added to it\n", envKey)
+		return data
+	}
+	setKey(root, envKey, envMap())
+	return root
+}
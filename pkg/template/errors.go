@@ -0,0 +1,58 @@
+package template
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+)
+
+// missingKeyPattern matches the error text/template reports for a missing map key with missingkey=error.
+// Errors from include and tpl are nested inside the outer error, so the last match is the most precise.
+var missingKeyPattern = regexp.MustCompile(`template: ([^:\s]+):(\d+):\d+: executing "[^"]*" at <([^>]*)>: map has no entry for key "([^"]*)"`)
+
+// MissingKeyError is returned when a template uses a key that is missing from the data
+type MissingKeyError struct {
+	File  string
+	Line  int
+	Field string
+	Key   string
+	Err   error
+}
+
+// Error implements the error interface
+func (e *MissingKeyError) Error() string {
+	return fmt.Sprintf("%s:%d: missing key %q in data (field %s)", e.File, e.Line, e.Key, e.Field)
+}
+
+// Unwrap returns the underlying template error
+func (e *MissingKeyError) Unwrap() error {
+	return e.Err
+}
+
+// describeError turns missing key errors into a MissingKeyError naming the template file.
+// Other errors are returned unchanged.
+func (s *templateSet) describeError(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	matches := missingKeyPattern.FindAllStringSubmatch(err.Error(), -1)
+	if len(matches) == 0 {
+		return err
+	}
+	match := matches[len(matches)-1]
+
+	file := match[1]
+	if path, ok := s.files[file]; ok {
+		file = path
+	}
+	line, _ := strconv.Atoi(match[2])
+
+	return &MissingKeyError{
+		File:  file,
+		Line:  line,
+		Field: match[3],
+		Key:   match[4],
+		Err:   err,
+	}
+}
@@ -0,0 +1,156 @@
+package template
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+)
+
+// fileSandbox resolves paths used by template file functions. Relative paths are resolved
+// against the template's directory and no path may point outside the source root.
+type fileSandbox struct {
+	root string
+	base string
+}
+
+// newFileSandbox creates a sandbox for a template directory inside the given source root
+func newFileSandbox(root, base string) (*fileSandbox, error) {
+	absRoot, err := filepath.Abs(root)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get absolute path for source root: %w", err)
+	}
+	absBase, err := filepath.Abs(base)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get absolute path for template directory: %w", err)
+	}
+	return &fileSandbox{root: absRoot, base: absBase}, nil
+}
+
+// funcs returns the file access functions bound to the sandbox
+func (s *fileSandbox) funcs() template.FuncMap {
+	return template.FuncMap{
+		"readFile":   s.readFile,
+		"fileExists": s.fileExists,
+		"glob":       s.glob,
+		"readDir":    s.readDir,
+	}
+}
+
+// resolve returns the absolute path for name, failing if it points outside the source root.
+// Symbolic links are followed so that a link can't be used to escape the root either.
+func (s *fileSandbox) resolve(name string) (string, error) {
+	path := name
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(s.base, path)
+	}
+	path = filepath.Clean(path)
+
+	if !isWithin(s.root, path) {
+		return "", fmt.Errorf("path %q is outside the source root %s", name, s.root)
+	}
+
+	// The root itself may be reached through a symlink, so compare resolved paths
+	if resolved, err := filepath.EvalSymlinks(path); err == nil {
+		root, err := filepath.EvalSymlinks(s.root)
+		if err != nil {
+			return "", fmt.Errorf("failed to resolve source root: %w", err)
+		}
+		if !isWithin(root, resolved) {
+			return "", fmt.Errorf("path %q resolves outside the source root %s", name, s.root)
+		}
+	}
+
+	return path, nil
+}
+
+// isWithin reports whether path is dir or one of its descendants
+func isWithin(dir, path string) bool {
+	rel, err := filepath.Rel(dir, path)
+	if err != nil {
+		return false
+	}
+	return rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// readFile returns the content of a file
+func (s *fileSandbox) readFile(name string) (string, error) {
+	path, err := s.resolve(name)
+	if err != nil {
+		return "", err
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("readFile: %w", err)
+	}
+	return string(content), nil
+}
+
+// fileExists reports whether a file or directory exists
+func (s *fileSandbox) fileExists(name string) (bool, error) {
+	path, err := s.resolve(name)
+	if err != nil {
+		return false, err
+	}
+	_, err = os.Stat(path)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("fileExists: %w", err)
+	}
+	return true, nil
+}
+
+// glob returns the files matching a pattern, relative to the template's directory when the
+// pattern is relative, so the results can be passed to readFile
+func (s *fileSandbox) glob(pattern string) ([]string, error) {
+	absPattern := pattern
+	if !filepath.IsAbs(absPattern) {
+		absPattern = filepath.Join(s.base, absPattern)
+	}
+	if !isWithin(s.root, filepath.Clean(absPattern)) {
+		return nil, fmt.Errorf("pattern %q is outside the source root %s", pattern, s.root)
+	}
+
+	matches, err := filepath.Glob(absPattern)
+	if err != nil {
+		return nil, fmt.Errorf("glob: %w", err)
+	}
+
+	results := make([]string, 0, len(matches))
+	for _, match := range matches {
+		// Skip matches that are symlinks leading out of the root
+		if _, err := s.resolve(match); err != nil {
+			continue
+		}
+		if !filepath.IsAbs(pattern) {
+			if rel, err := filepath.Rel(s.base, match); err == nil {
+				match = rel
+			}
+		}
+		results = append(results, match)
+	}
+	sort.Strings(results)
+	return results, nil
+}
+
+// readDir returns the sorted names of the entries in a directory
+func (s *fileSandbox) readDir(name string) ([]string, error) {
+	path, err := s.resolve(name)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		return nil, fmt.Errorf("readDir: %w", err)
+	}
+
+	names := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	return names, nil
+}
@@ -43,8 +43,8 @@ func (f *TemplateFinder) FindTemplates(templateName string) ([]string, error) {
 		return nil, fmt.Errorf("root path is not a directory: %s", absRootDir)
 	}
 
-	fmt.Printf("Searching for templates in %s\n", absRootDir)
-	fmt.Printf("Looking for template: %s\n", templateName)
+	logf("Searching for templates in %s\n", absRootDir)
+	logf("Looking for template: %s\n", templateName)
 
 	var templateFiles []string
 
@@ -53,7 +53,7 @@ func (f *TemplateFinder) FindTemplates(templateName string) ([]string, error) {
 		err := filepath.Walk(absRootDir, func(path string, info os.FileInfo, err error) error {
 			if err != nil {
 				// Log the error but continue walking
-				fmt.Printf("Warning: skipping path %s due to error: %v\n", path, err)
+				logf("Warning: skipping path %s due to error: %v\n", path, err)
 				return nil
 			}
 
@@ -63,7 +63,7 @@ func (f *TemplateFinder) FindTemplates(templateName string) ([]string, error) {
 			}
 
 			templateFiles = append(templateFiles, path)
-			fmt.Printf("Found template: %s\n", path)
+			logf("Found template: %s\n", path)
 			return nil
 		})
 
@@ -87,7 +87,7 @@ func (f *TemplateFinder) FindTemplates(templateName string) ([]string, error) {
 		}
 
 		templateFiles = []string{templatePath}
-		fmt.Printf("Found template: %s\n", templatePath)
+		logf("Found template: %s\n", templatePath)
 	}
 
 	if len(templateFiles) == 0 {
@@ -105,15 +105,12 @@ func isTemplateFile(filename string) bool {
 	return filename == config.TemplateFile
 }
 
-// GetDataFileForTemplate returns the path to the data file for a template
+// GetDataFileForTemplate returns the path to the data file for a template, which may be
+// any of the supported data formats
 func (f *TemplateFinder) GetDataFileForTemplate(templatePath string) (string, error) {
-	templateDir := filepath.Dir(templatePath)
-	dataPath := filepath.Join(templateDir, config.DataFile)
-
-	// Check if the data file exists
-	if _, err := os.Stat(dataPath); err != nil {
-		return "", fmt.Errorf("data file '%s' not found for template '%s': %w",
-			config.DataFile, templatePath, err)
+	dataPath, err := FindDataFile(filepath.Dir(templatePath))
+	if err != nil {
+		return "", fmt.Errorf("data file for template '%s': %w", templatePath, err)
 	}
 
 	return dataPath, nil
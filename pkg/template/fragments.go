@@ -0,0 +1,222 @@
+package template
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/Samet-MohamedAmin/gotmpl/pkg/config"
+	"gopkg.in/yaml.v3"
+)
+
+// overrideTag marks a value of a data fragment that replaces a value set before it
+const overrideTag = "!override"
+
+// fragmentExtensions are the extensions of the files read from a data directory
+var fragmentExtensions = []string{".yaml", ".yml", ".json"}
+
+// dataDirName returns the name of the data directory of a template: the data file stem
+// followed by ".d", so data.yaml goes with data.d
+func dataDirName() string {
+	return strings.TrimSuffix(config.DataFile, filepath.Ext(config.DataFile)) + ".d"
+}
+
+// FindDataFragments returns the YAML and JSON fragments of the data directory in dir, in
+// lexical order. It returns nil when there is no data directory.
+func FindDataFragments(dir string) ([]string, error) {
+	dataDir := filepath.Join(dir, dataDirName())
+	entries, err := os.ReadDir(dataDir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read data directory: %w", err)
+	}
+
+	var fragments []string
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		ext := strings.ToLower(filepath.Ext(entry.Name()))
+		for _, supported := range fragmentExtensions {
+			if ext == supported {
+				fragments = append(fragments, filepath.Join(dataDir, entry.Name()))
+				break
+			}
+		}
+	}
+	sort.Strings(fragments)
+	return fragments, nil
+}
+
+// dataFragment is a decoded data fragment
+type dataFragment struct {
+	path   string
+	values map[string]interface{}
+	// overrides holds the JSON pointers of the values tagged !override
+	overrides map[string]bool
+}
+
+// loadFragment loads a data fragment. It must hold a single mapping.
+func (p *TemplateProcessor) loadFragment(path string) (*dataFragment, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read data fragment: %w", err)
+	}
+
+	fragment := &dataFragment{path: path, overrides: make(map[string]bool)}
+	var documents []interface{}
+	if strings.ToLower(filepath.Ext(path)) == ".json" {
+		documents, err = decodeDocuments(path, content, p.rootDir(path), p.secrets)
+	} else {
+		documents, err = decodeYAMLFragment(path, content, p.rootDir(path), fragment.overrides, p.secrets)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("data fragment %s: %w", path, err)
+	}
+	if len(documents) > 1 {
+		return nil, fmt.Errorf("data fragment %s has %d documents, expected one", path, len(documents))
+	}
+
+	switch values := documents[0].(type) {
+	case nil:
+		fragment.values = map[string]interface{}{}
+	case map[string]interface{}:
+		fragment.values = values
+	default:
+		return nil, fmt.Errorf("data fragment %s is not a mapping", path)
+	}
+	return fragment, nil
+}
+
+// decodeYAMLFragment decodes a YAML fragment, recording the pointers of the values tagged
+// !override
+func decodeYAMLFragment(path string, content []byte, root string, overrides map[string]bool, secrets *secretSet) ([]interface{}, error) {
+	nodes, _, err := parseDataNodes(path, content, root, secrets)
+	if err != nil {
+		return nil, err
+	}
+	for _, node := range nodes {
+		recordOverrides(node, "", overrides)
+	}
+	return decodeNodes(nodes)
+}
+
+// recordOverrides removes the !override tags below node, recording the JSON pointers of the
+// tagged values in overrides when it is not nil. The marker only matters in data fragments,
+// elsewhere the values are used as if they were not tagged.
+func recordOverrides(node *yaml.Node, pointer string, overrides map[string]bool) {
+	if node.Tag == overrideTag {
+		// Without a tag, the value type is resolved as usual
+		node.Tag = ""
+		if overrides != nil {
+			overrides[pointer] = true
+		}
+	}
+
+	switch node.Kind {
+	case yaml.DocumentNode:
+		for _, child := range node.Content {
+			recordOverrides(child, pointer, overrides)
+		}
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			recordOverrides(node.Content[i+1], pointer+"/"+escapePointer(node.Content[i].Value), overrides)
+		}
+	case yaml.SequenceNode:
+		for i, item := range node.Content {
+			recordOverrides(item, pointer+"/"+strconv.Itoa(i), overrides)
+		}
+	}
+}
+
+// fragmentMerge merges data sources one after the other, remembering which source set each
+// value so that conflicts can be reported
+type fragmentMerge struct {
+	values map[string]interface{}
+	// owners holds the source that set each value, by JSON pointer
+	owners map[string]string
+}
+
+// newFragmentMerge starts a merge with the values of a data file, which owns every value
+// until a fragment sets it
+func newFragmentMerge(path string, data map[string]interface{}) *fragmentMerge {
+	return &fragmentMerge{values: copyMap(data), owners: map[string]string{"": path}}
+}
+
+// add merges a fragment over the values merged so far. Maps are merged key by key; any
+// other value may only be set once, unless the fragment tags it !override.
+func (m *fragmentMerge) add(fragment *dataFragment) error {
+	return m.merge(m.values, fragment.values, "", fragment.path, fragment.overrides)
+}
+
+// merge merges src into dst at a pointer
+func (m *fragmentMerge) merge(dst, src map[string]interface{}, pointer, source string, overrides map[string]bool) error {
+	for _, key := range orderedKeys(src) {
+		srcValue := src[key]
+		keyPointer := pointer + "/" + escapePointer(key)
+		dstValue, exists := dst[key]
+
+		if overrides[keyPointer] {
+			if srcValue == nil {
+				delete(dst, key)
+			} else {
+				setKey(dst, key, copyValue(srcValue))
+			}
+			m.owners[keyPointer] = source
+			continue
+		}
+
+		srcMap, srcIsMap := srcValue.(map[string]interface{})
+		dstMap, dstIsMap := dstValue.(map[string]interface{})
+		switch {
+		case !exists:
+			setKey(dst, key, copyValue(srcValue))
+			m.owners[keyPointer] = source
+		case srcIsMap && dstIsMap:
+			if err := m.merge(dstMap, srcMap, keyPointer, source, overrides); err != nil {
+				return err
+			}
+		case jsonEqual(srcValue, dstValue):
+			// Setting the same value twice is not a conflict
+		default:
+			return fmt.Errorf("%s sets %s, already set by %s; tag the value with %s to replace it",
+				source, displayPointer(keyPointer), m.owner(keyPointer), overrideTag)
+		}
+	}
+	return nil
+}
+
+// owner returns the source that set the value at a pointer, or the map holding it
+func (m *fragmentMerge) owner(pointer string) string {
+	for {
+		if source, ok := m.owners[pointer]; ok || pointer == "" {
+			return source
+		}
+		pointer = pointer[:strings.LastIndex(pointer, "/")]
+	}
+}
+
+// mergeFragments merges the data fragments over a data document
+func mergeFragments(dataPath string, document interface{}, fragments []*dataFragment) (interface{}, error) {
+	var base map[string]interface{}
+	switch values := document.(type) {
+	case nil:
+	case map[string]interface{}:
+		base = values
+	default:
+		return nil, fmt.Errorf("data file %s is not a mapping, so data fragments can't be merged into it", dataPath)
+	}
+
+	merged := newFragmentMerge(dataPath, base)
+	for _, fragment := range fragments {
+		if err := merged.add(fragment); err != nil {
+			return nil, err
+		}
+	}
+	return merged.values, nil
+}
@@ -0,0 +1,116 @@
+package template
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Samet-MohamedAmin/gotmpl/pkg/config"
+)
+
+func TestProcessTemplateDataFragments(t *testing.T) {
+	testCases := []struct {
+		name     string
+		files    map[string]string
+		expected string
+		err      string
+	}{
+		{
+			name: "Fragments merged over the data file",
+			files: map[string]string{
+				"data.yaml":              "name: app\nimage:\n  repo: nginx\n",
+				"data.d/10-image.yaml":   "image:\n  tag: \"1.27\"\n",
+				"data.d/20-ports.json":   `{"ports": [80, 443]}`,
+				"data.d/30-same.yaml":    "name: app\n",
+				"data.d/README.md":       "Not a fragment\n",
+				"data.d/nested/x.yaml":   "ignored: true\n",
+				"data.d/40-extra.yml":    "extra: true\n",
+				"data.d/50-ignored.toml": "ignored = true\n",
+			},
+			expected: "app nginx:1.27 [80 443] true <no value>",
+		},
+		{
+			name: "Fragments without a data file",
+			files: map[string]string{
+				"data.d/a.yaml": "name: app\nimage:\n  repo: nginx\n",
+				"data.d/b.yaml": "image:\n  tag: latest\n",
+			},
+			expected: "app nginx:latest <no value> <no value> <no value>",
+		},
+		{
+			name: "Override marker",
+			files: map[string]string{
+				"data.yaml":     "name: app\nimage:\n  repo: nginx\n  tag: \"1.25\"\nports: [80]\n",
+				"data.d/a.yaml": "image:\n  tag: !override \"1.27\"\nports: !override [8080]\n",
+				"data.d/b.yaml": "image: !override\n  repo: httpd\n  tag: \"2.4\"\n",
+			},
+			expected: "app httpd:2.4 [8080] <no value> <no value>",
+		},
+		{
+			name: "Override marker outside fragments",
+			files: map[string]string{
+				"data.yaml": "name: !override app\nports: [!override 80]\n",
+			},
+			expected: "app <no value>:<no value> [80] <no value> <no value>",
+		},
+		{
+			name: "Conflict with the data file",
+			files: map[string]string{
+				"data.yaml":     "name: app\nimage:\n  tag: \"1.25\"\n",
+				"data.d/a.yaml": "image:\n  tag: \"1.27\"\n",
+			},
+			err: "data.d/a.yaml sets /image/tag, already set by ",
+		},
+		{
+			name: "Conflict between fragments",
+			files: map[string]string{
+				"data.d/a.yaml": "image:\n  repo: nginx\n",
+				"data.d/b.yaml": "image: nginx\n",
+			},
+			err: "data.d/b.yaml sets /image, already set by ",
+		},
+		{
+			name:  "Fragment is not a mapping",
+			files: map[string]string{"data.d/a.yaml": "- a\n"},
+			err:   "is not a mapping",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			srcDir := t.TempDir()
+			config.Reset()
+			config.OutputDir = t.TempDir()
+			defer config.Reset()
+
+			files := map[string]string{
+				"template.go.tmpl": "{{ .name }} {{ .image.repo }}:{{ .image.tag }} {{ .ports }} {{ .extra }} {{ .ignored }}",
+			}
+			for name, content := range tc.files {
+				files[name] = content
+			}
+			writeFiles(t, srcDir, files)
+
+			processor := NewProcessor(false)
+			err := processor.ProcessTemplate(filepath.Join(srcDir, config.TemplateFile), false)
+			if tc.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.err) {
+					t.Errorf("Expected error containing %q, got %v", tc.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ProcessTemplate failed: %v", err)
+			}
+
+			content, err := os.ReadFile(filepath.Join(config.OutputDir, config.DefaultPrefix))
+			if err != nil {
+				t.Fatalf("Failed to read output: %v", err)
+			}
+			if strings.TrimSpace(string(content)) != tc.expected {
+				t.Errorf("Expected output %q, got %q", tc.expected, content)
+			}
+		})
+	}
+}
@@ -0,0 +1,382 @@
+package template
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	htmltemplate "html/template"
+	"io"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"gopkg.in/yaml.v3"
+)
+
+// builtinFuncs returns the function library registered on every template
+func builtinFuncs() template.FuncMap {
+	return template.FuncMap{
+		// Serialization
+		"toJson":       toJSON,
+		"toPrettyJson": toPrettyJSON,
+		"toYaml":       toYAML,
+		"fromJson":     fromJSON,
+		"fromYaml":     fromYAML,
+
+		// Strings
+		"indent":     indent,
+		"nindent":    nindent,
+		"trim":       strings.TrimSpace,
+		"trimPrefix": func(prefix, s string) string { return strings.TrimPrefix(s, prefix) },
+		"trimSuffix": func(suffix, s string) string { return strings.TrimSuffix(s, suffix) },
+		"replace":    func(old, replacement, s string) string { return strings.ReplaceAll(s, old, replacement) },
+		"upper":      strings.ToUpper,
+		"lower":      strings.ToLower,
+		"repeat":     func(count int, s string) string { return strings.Repeat(s, count) },
+		"contains":   func(substr, s string) bool { return strings.Contains(s, substr) },
+		"hasPrefix":  func(prefix, s string) bool { return strings.HasPrefix(s, prefix) },
+		"hasSuffix":  func(suffix, s string) bool { return strings.HasSuffix(s, suffix) },
+		"splitList":  func(sep, s string) []string { return strings.Split(s, sep) },
+		"join":       join,
+		"quote":      quote,
+		"squote":     squote,
+		"toString":   toString,
+		"safeHTML":   safeHTML,
+
+		// Case conversion and inflection
+		"camelCase":     camelCase,
+		"pascalCase":    pascalCase,
+		"snakeCase":     snakeCase,
+		"kebabCase":     kebabCase,
+		"screamingCase": screamingCase,
+		"goCamelCase":   goCamelCase,
+		"goPascalCase":  goPascalCase,
+		"pluralize":     pluralize,
+		"singularize":   singularize,
+
+		// Paths
+		"base": filepath.Base,
+		"dir":  filepath.Dir,
+		"ext":  filepath.Ext,
+
+		// Encoding and hashing
+		"base64enc":  base64Encode,
+		"base64dec":  base64Decode,
+		"base32enc":  base32Encode,
+		"base32dec":  base32Decode,
+		"hexenc":     hexEncode,
+		"hexdec":     hexDecode,
+		"sha1sum":    sha1Sum,
+		"sha256sum":  sha256Sum,
+		"adler32sum": adler32Sum,
+		"uuidv5":     uuidv5,
+
+		// Defaults
+		"default":  defaultValue,
+		"empty":    empty,
+		"coalesce": coalesce,
+		"ternary":  ternary,
+
+		// Collections
+		"dict":           dict,
+		"list":           list,
+		"append":         appendList,
+		"merge":          merge,
+		"mergeOverwrite": mergeOverwrite,
+		"keys":           keys,
+		"values":         values,
+		"pick":           pick,
+		"omit":           omit,
+		"hasKey":         hasKey,
+		"dig":            dig,
+		"uniq":           uniq,
+		"sortAlpha":      sortAlpha,
+		"sortBy":         sortBy,
+		"groupBy":        groupBy,
+		"first":          first,
+		"last":           last,
+		"rest":           rest,
+		"until":          until,
+		"seq":            seq,
+
+		// Math
+		"add": add,
+		"sub": sub,
+		"mul": mul,
+		"div": div,
+		"mod": mod,
+		"max": maxOf,
+		"min": minOf,
+
+		// Regular expressions
+		"regexMatch":      regexMatch,
+		"regexFind":       regexFind,
+		"regexFindAll":    regexFindAll,
+		"regexReplaceAll": regexReplaceAll,
+		"regexSplit":      regexSplit,
+	}
+}
+
+// toJSON encodes a value as compact JSON
+func toJSON(v interface{}) (string, error) {
+	out, err := json.Marshal(jsonCompatible(v))
+	if err != nil {
+		return "", fmt.Errorf("toJson: %w", err)
+	}
+	return string(out), nil
+}
+
+// toPrettyJSON encodes a value as JSON indented with two spaces
+func toPrettyJSON(v interface{}) (string, error) {
+	out, err := json.MarshalIndent(jsonCompatible(v), "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("toPrettyJson: %w", err)
+	}
+	return string(out), nil
+}
+
+// toYAML encodes a value as YAML without the trailing newline. With DataOrder preserve,
+// maps keep their key order.
+func toYAML(v interface{}) (string, error) {
+	if preserveOrder() {
+		node, err := orderedNode(v)
+		if err != nil {
+			return "", fmt.Errorf("toYaml: %w", err)
+		}
+		v = node
+	}
+
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(v); err != nil {
+		return "", fmt.Errorf("toYaml: %w", err)
+	}
+	if err := encoder.Close(); err != nil {
+		return "", fmt.Errorf("toYaml: %w", err)
+	}
+	return strings.TrimSuffix(buf.String(), "\n"), nil
+}
+
+// fromJSON decodes a JSON document, recording the key order of its objects
+func fromJSON(s string) (interface{}, error) {
+	decoder := json.NewDecoder(strings.NewReader(s))
+	v, err := jsonValue(decoder)
+	if err != nil {
+		return nil, fmt.Errorf("fromJson: %w", err)
+	}
+	if _, err := decoder.Token(); err != io.EOF {
+		return nil, fmt.Errorf("fromJson: unexpected content after the document")
+	}
+	return v, nil
+}
+
+// fromYAML decodes a YAML document, recording the key order of its maps
+func fromYAML(s string) (interface{}, error) {
+	var node yaml.Node
+	if err := yaml.Unmarshal([]byte(s), &node); err != nil {
+		return nil, fmt.Errorf("fromYaml: %w", err)
+	}
+	var v interface{}
+	if node.Kind == 0 {
+		return v, nil
+	}
+	if err := node.Decode(&v); err != nil {
+		return nil, fmt.Errorf("fromYaml: %w", err)
+	}
+	recordOrder(&node, v)
+	return v, nil
+}
+
+// jsonCompatible converts maps with non-string keys, which YAML allows, into string-keyed maps.
+// With DataOrder preserve, string-keyed maps become objects that keep their key order.
+func jsonCompatible(v interface{}) interface{} {
+	switch value := v.(type) {
+	case map[interface{}]interface{}:
+		converted := make(map[string]interface{}, len(value))
+		for key, item := range value {
+			converted[toString(key)] = jsonCompatible(item)
+		}
+		return converted
+	case map[string]interface{}:
+		converted := make(map[string]interface{}, len(value))
+		for key, item := range value {
+			converted[key] = jsonCompatible(item)
+		}
+		if preserveOrder() {
+			return orderedObject{keys: orderedKeys(value), values: converted}
+		}
+		return converted
+	case []interface{}:
+		converted := make([]interface{}, len(value))
+		for i, item := range value {
+			converted[i] = jsonCompatible(item)
+		}
+		return converted
+	default:
+		return v
+	}
+}
+
+// indent prefixes every line of s with the given number of spaces
+func indent(spaces int, s string) string {
+	pad := strings.Repeat(" ", spaces)
+	return pad + strings.ReplaceAll(s, "\n", "\n"+pad)
+}
+
+// nindent is like indent but starts with a newline, for use after a YAML key
+func nindent(spaces int, s string) string {
+	return "\n" + indent(spaces, s)
+}
+
+// join joins the string form of every element of a list
+func join(sep string, list interface{}) string {
+	items := toList(list)
+	parts := make([]string, 0, len(items))
+	for _, item := range items {
+		parts = append(parts, toString(item))
+	}
+	return strings.Join(parts, sep)
+}
+
+// quote wraps the string form of a value in double quotes, escaping as needed
+func quote(v interface{}) string {
+	return strconv.Quote(toString(v))
+}
+
+// squote wraps the string form of a value in single quotes
+func squote(v interface{}) string {
+	return "'" + toString(v) + "'"
+}
+
+// safeHTML marks trusted text as HTML, so the html engine inserts it without escaping it
+func safeHTML(text string) htmltemplate.HTML {
+	return htmltemplate.HTML(text)
+}
+
+// toString converts a value to its string form, treating nil as the empty string
+func toString(v interface{}) string {
+	switch value := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return value
+	case []byte:
+		return string(value)
+	case fmt.Stringer:
+		return value.String()
+	case error:
+		return value.Error()
+	default:
+		return fmt.Sprint(value)
+	}
+}
+
+// toList converts any slice or array to a []interface{}, wrapping other values in a list
+func toList(v interface{}) []interface{} {
+	if v == nil {
+		return nil
+	}
+	if list, ok := v.([]interface{}); ok {
+		return list
+	}
+
+	value := reflect.ValueOf(v)
+	if value.Kind() != reflect.Slice && value.Kind() != reflect.Array {
+		return []interface{}{v}
+	}
+
+	list := make([]interface{}, value.Len())
+	for i := range list {
+		list[i] = value.Index(i).Interface()
+	}
+	return list
+}
+
+// defaultValue returns the given value unless it is empty, in which case d is returned.
+// The given value is variadic so that "default" works at the end of a pipeline on a missing key.
+func defaultValue(d interface{}, given ...interface{}) interface{} {
+	if len(given) == 0 || empty(given[0]) {
+		return d
+	}
+	return given[0]
+}
+
+// empty reports whether a value is nil or the zero value of its type
+func empty(v interface{}) bool {
+	if v == nil {
+		return true
+	}
+
+	value := reflect.ValueOf(v)
+	switch value.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String, reflect.Chan:
+		return value.Len() == 0
+	case reflect.Pointer, reflect.Interface:
+		return value.IsNil()
+	default:
+		return value.IsZero()
+	}
+}
+
+// coalesce returns the first non-empty value
+func coalesce(values ...interface{}) interface{} {
+	for _, v := range values {
+		if !empty(v) {
+			return v
+		}
+	}
+	return nil
+}
+
+// ternary returns vt if the condition holds and vf otherwise
+func ternary(vt, vf interface{}, condition bool) interface{} {
+	if condition {
+		return vt
+	}
+	return vf
+}
+
+// regexMatch reports whether s contains a match of the regular expression
+func regexMatch(regex, s string) (bool, error) {
+	return regexp.MatchString(regex, s)
+}
+
+// regexFind returns the first match of the regular expression in s
+func regexFind(regex, s string) (string, error) {
+	re, err := regexp.Compile(regex)
+	if err != nil {
+		return "", err
+	}
+	return re.FindString(s), nil
+}
+
+// regexFindAll returns up to n matches of the regular expression in s (all of them if n < 0)
+func regexFindAll(regex, s string, n int) ([]string, error) {
+	re, err := regexp.Compile(regex)
+	if err != nil {
+		return nil, err
+	}
+	return re.FindAllString(s, n), nil
+}
+
+// regexReplaceAll replaces every match of the regular expression in s, expanding $1 style references
+func regexReplaceAll(regex, s, replacement string) (string, error) {
+	re, err := regexp.Compile(regex)
+	if err != nil {
+		return "", err
+	}
+	return re.ReplaceAllString(s, replacement), nil
+}
+
+// regexSplit splits s around matches of the regular expression into at most n parts (all if n < 0)
+func regexSplit(regex, s string, n int) ([]string, error) {
+	re, err := regexp.Compile(regex)
+	if err != nil {
+		return nil, err
+	}
+	return re.Split(s, n), nil
+}
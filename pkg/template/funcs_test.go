@@ -0,0 +1,323 @@
+package template
+
+import (
+	"bytes"
+	"testing"
+	"text/template"
+	"time"
+)
+
+// execFuncTemplate renders a template string using the built-in function library
+func execFuncTemplate(t *testing.T, text string, data interface{}) (string, error) {
+	t.Helper()
+
+	tmpl, err := template.New("test").Funcs(builtinFuncs()).Parse(text)
+	if err != nil {
+		return "", err
+	}
+
+	var buf bytes.Buffer
+	err = tmpl.Execute(&buf, data)
+	return buf.String(), err
+}
+
+func TestBuiltinFuncs(t *testing.T) {
+	data := map[string]interface{}{
+		"Name":  "web",
+		"Empty": "",
+		"Labels": map[string]interface{}{
+			"app":  "web",
+			"tier": "frontend",
+		},
+		"Ports": []interface{}{80, 443},
+	}
+
+	testCases := []struct {
+		name     string
+		template string
+		expected string
+	}{
+		{"toJson", `{{ .Labels | toJson }}`, `{"app":"web","tier":"frontend"}`},
+		{"toPrettyJson", `{{ .Ports | toPrettyJson }}`, "[\n  80,\n  443\n]"},
+		{"toYaml", `{{ .Labels | toYaml }}`, "app: web\ntier: frontend"},
+		{"fromJson", `{{ (fromJson "{\"a\": [1, 2]}").a }}`, "[1 2]"},
+		{"fromYaml", `{{ (fromYaml "a: b").a }}`, "b"},
+		{"indent", `{{ "a\nb" | indent 2 }}`, "  a\n  b"},
+		{"nindent", `labels:{{ .Labels | toYaml | nindent 2 }}`, "labels:\n  app: web\n  tier: frontend"},
+		{"trim", `{{ "  x  " | trim }}`, "x"},
+		{"replace", `{{ "a-b-c" | replace "-" "_" }}`, "a_b_c"},
+		{"upper and lower", `{{ upper "a" }}{{ lower "B" }}`, "Ab"},
+		{"quote", `{{ .Name | quote }} {{ .Name | squote }}`, `"web" 'web'`},
+		{"join", `{{ .Ports | join "," }}`, "80,443"},
+		{"default on empty", `{{ .Empty | default "none" }}`, "none"},
+		{"default on missing", `{{ .Missing | default "none" }}`, "none"},
+		{"default keeps value", `{{ .Name | default "none" }}`, "web"},
+		{"empty", `{{ empty .Empty }} {{ empty .Ports }}`, "true false"},
+		{"coalesce", `{{ coalesce .Missing .Empty .Name }}`, "web"},
+		{"ternary", `{{ ternary "yes" "no" true }}`, "yes"},
+		{"regexMatch", `{{ regexMatch "^w.b$" .Name }}`, "true"},
+		{"regexFind", `{{ regexFind "[0-9]+" "abc123def" }}`, "123"},
+		{"regexFindAll", `{{ regexFindAll "[0-9]" "a1b2c3" -1 }}`, "[1 2 3]"},
+		{"regexReplaceAll", `{{ regexReplaceAll "(\\w+)@(\\w+)" "me@host" "${2}:${1}" }}`, "host:me"},
+		{"regexSplit", `{{ regexSplit "\\s*,\\s*" "a , b,c" -1 }}`, "[a b c]"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			output, err := execFuncTemplate(t, tc.template, data)
+			if err != nil {
+				t.Fatalf("Template failed: %v", err)
+			}
+			if output != tc.expected {
+				t.Errorf("Expected %q, got %q", tc.expected, output)
+			}
+		})
+	}
+}
+
+func TestBuiltinFuncsErrors(t *testing.T) {
+	testCases := []struct {
+		name     string
+		template string
+	}{
+		{"invalid JSON", `{{ fromJson "{" }}`},
+		{"invalid YAML", `{{ fromYaml "a: [" }}`},
+		{"invalid regex", `{{ regexMatch "(" "x" }}`},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := execFuncTemplate(t, tc.template, nil); err == nil {
+				t.Error("Expected template execution to fail")
+			}
+		})
+	}
+}
+
+func TestCaseFuncs(t *testing.T) {
+	testCases := []struct {
+		input    string
+		fn       func(string) string
+		expected string
+	}{
+		{"user_id", camelCase, "userId"},
+		{"HTTPServer", camelCase, "httpServer"},
+		{"user-account name", pascalCase, "UserAccountName"},
+		{"userAccountID", snakeCase, "user_account_id"},
+		{"base64Encode", snakeCase, "base64_encode"},
+		{"UserAccount", kebabCase, "user-account"},
+		{"maxRetryCount", screamingCase, "MAX_RETRY_COUNT"},
+		{"user_id", goPascalCase, "UserID"},
+		{"http_server_url", goPascalCase, "HTTPServerURL"},
+		{"api-key", goPascalCase, "APIKey"},
+		{"user_id", goCamelCase, "userID"},
+		{"URL", goCamelCase, "url"},
+		{"URLs", goPascalCase, "URLs"},
+		{"IDs", goPascalCase, "IDs"},
+		{"userIDs", goPascalCase, "UserIDs"},
+		{"user_ids", goCamelCase, "userIDs"},
+		{"URLsList", snakeCase, "urls_list"},
+		{"userIDs", snakeCase, "user_ids"},
+		{"HTTPServer", snakeCase, "http_server"},
+		{"Users", goPascalCase, "Users"},
+		{"größe_maß", pascalCase, "GrößeMaß"},
+		{"ÉtéChaud", snakeCase, "été_chaud"},
+		{"Ωmega_δelta", camelCase, "ωmegaΔelta"},
+	}
+
+	for _, tc := range testCases {
+		if result := tc.fn(tc.input); result != tc.expected {
+			t.Errorf("Converting %q: expected %q, got %q", tc.input, tc.expected, result)
+		}
+	}
+}
+
+func TestInflection(t *testing.T) {
+	testCases := []struct {
+		singular string
+		plural   string
+	}{
+		{"user", "users"},
+		{"category", "categories"},
+		{"status", "statuses"},
+		{"box", "boxes"},
+		{"match", "matches"},
+		{"person", "people"},
+		{"child", "children"},
+		{"knife", "knives"},
+		{"analysis", "analyses"},
+		{"index", "indices"},
+		{"day", "days"},
+		{"sheep", "sheep"},
+		{"UserAccount", "UserAccounts"},
+		{"user_category", "user_categories"},
+		{"Person", "People"},
+		{"ADDRESS", "ADDRESSES"},
+	}
+
+	for _, tc := range testCases {
+		if result := pluralize(tc.singular); result != tc.plural {
+			t.Errorf("pluralize(%q): expected %q, got %q", tc.singular, tc.plural, result)
+		}
+		if result := singularize(tc.plural); result != tc.singular {
+			t.Errorf("singularize(%q): expected %q, got %q", tc.plural, tc.singular, result)
+		}
+	}
+}
+
+func TestEncodingFuncs(t *testing.T) {
+	testCases := []struct {
+		name     string
+		template string
+		expected string
+	}{
+		{"base64", `{{ "hello" | base64enc }} {{ "aGVsbG8=" | base64dec }}`, "aGVsbG8= hello"},
+		{"base32", `{{ "hello" | base32enc }} {{ "NBSWY3DP" | base32dec }}`, "NBSWY3DP hello"},
+		{"hex", `{{ "hello" | hexenc }} {{ "68656c6c6f" | hexdec }}`, "68656c6c6f hello"},
+		{"sha1sum", `{{ "hello" | sha1sum }}`, "aaf4c61ddcc5e8a2dabede0f3b482cd9aea9434d"},
+		{"sha256sum", `{{ "hello" | sha256sum }}`, "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"},
+		{"adler32sum", `{{ "hello" | adler32sum }}`, "103547413"},
+		{"uuidv5 with predefined name space", `{{ uuidv5 "dns" "www.example.com" }}`, "2ed6657d-e927-568b-95e1-2665a8aea6a2"},
+		{"uuidv5 with UUID name space", `{{ uuidv5 "6ba7b811-9dad-11d1-80b4-00c04fd430c8" "https://example.com" }}`, "4fd35a71-71ef-5a55-a9d9-aa75c889a6d0"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			output, err := execFuncTemplate(t, tc.template, nil)
+			if err != nil {
+				t.Fatalf("Template failed: %v", err)
+			}
+			if output != tc.expected {
+				t.Errorf("Expected %q, got %q", tc.expected, output)
+			}
+		})
+	}
+
+	if _, err := execFuncTemplate(t, `{{ uuidv5 "not-a-uuid" "x" }}`, nil); err == nil {
+		t.Error("Expected uuidv5 to fail for an invalid name space")
+	}
+}
+
+func TestTimeFuncs(t *testing.T) {
+	now := time.Date(2024, 3, 1, 12, 30, 0, 0, time.UTC)
+
+	testCases := []struct {
+		name     string
+		template string
+		expected string
+	}{
+		{"now", `{{ now | date "2006-01-02T15:04:05Z07:00" }}`, "2024-03-01T12:30:00Z"},
+		{"date", `{{ date "Jan 2, 2006" now }}`, "Mar 1, 2024"},
+		{"dateModify", `{{ now | dateModify "+48h" | date "2006-01-02" }}`, "2024-03-03"},
+		{"negative dateModify", `{{ now | dateModify "-30m" | date "15:04" }}`, "12:00"},
+		{"unixEpoch", `{{ unixEpoch now }}`, "1709296200"},
+		{"date from Unix seconds", `{{ date "2006-01-02" 0 }}`, "1970-01-01"},
+		{"toDate", `{{ toDate "2006-01-02" "2025-12-31" | date "02/01/2006" }}`, "31/12/2025"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			tmpl, err := template.New("test").Funcs(timeFuncs(now)).Parse(tc.template)
+			if err != nil {
+				t.Fatalf("Failed to parse template: %v", err)
+			}
+			var buf bytes.Buffer
+			if err := tmpl.Execute(&buf, nil); err != nil {
+				t.Fatalf("Template failed: %v", err)
+			}
+			if buf.String() != tc.expected {
+				t.Errorf("Expected %q, got %q", tc.expected, buf.String())
+			}
+		})
+	}
+}
+
+func TestCollectionFuncs(t *testing.T) {
+	data := map[string]interface{}{
+		"Defaults": map[string]interface{}{
+			"image":     map[string]interface{}{"repository": "nginx", "tag": "1.25"},
+			"replicas":  1,
+			"resources": []interface{}{"cpu"},
+		},
+		"Overrides": map[string]interface{}{
+			"image":    map[string]interface{}{"tag": "1.27"},
+			"replicas": 3,
+		},
+		"Services": []interface{}{
+			map[string]interface{}{"name": "web", "tier": "frontend", "port": 8080},
+			map[string]interface{}{"name": "api", "tier": "backend", "port": 443},
+			map[string]interface{}{"name": "db", "tier": "backend", "port": 5432},
+		},
+		"Tags": []interface{}{"b", "a", "b", "c"},
+	}
+
+	testCases := []struct {
+		name     string
+		template string
+		expected string
+	}{
+		{"dict", `{{ $d := dict "a" 1 "b" "two" }}{{ $d.a }} {{ $d.b }}`, "1 two"},
+		{"list and append", `{{ append (list 1 2) 3 }}`, "[1 2 3]"},
+		{"append keeps source", `{{ $l := list 1 }}{{ $m := append $l 2 }}{{ $l }} {{ $m }}`, "[1] [1 2]"},
+		{"merge", `{{ (merge .Overrides .Defaults).image }} {{ (merge .Overrides .Defaults).replicas }}`, "map[repository:nginx tag:1.27] 3"},
+		{"mergeOverwrite", `{{ (mergeOverwrite .Defaults .Overrides).image.tag }} {{ .Defaults.image.tag }}`, "1.27 1.25"},
+		{"keys", `{{ keys .Defaults }}`, "[image replicas resources]"},
+		{"keys of several maps", `{{ keys .Defaults .Overrides (dict "z" 1) }}`, "[image replicas resources z]"},
+		{"values", `{{ values (dict "b" 2 "a" 1) }}`, "[1 2]"},
+		{"pick", `{{ pick .Defaults "replicas" "missing" }}`, "map[replicas:1]"},
+		{"omit", `{{ keys (omit .Defaults "image") }}`, "[replicas resources]"},
+		{"hasKey", `{{ hasKey .Defaults "image" }} {{ hasKey .Defaults "other" }}`, "true false"},
+		{"dig", `{{ dig "image" "tag" "latest" .Defaults }}`, "1.25"},
+		{"dig default", `{{ dig "image" "digest" "none" .Defaults }}`, "none"},
+		{"dig through a scalar", `{{ dig "replicas" "x" "none" .Defaults }}`, "none"},
+		{"uniq", `{{ uniq .Tags }}`, "[b a c]"},
+		{"sortAlpha", `{{ sortAlpha .Tags }}`, "[a b b c]"},
+		{"sortBy string field", `{{ range sortBy "name" .Services }}{{ .name }} {{ end }}`, "api db web "},
+		{"sortBy numeric field", `{{ range sortBy "port" .Services }}{{ .port }} {{ end }}`, "443 5432 8080 "},
+		{"groupBy", `{{ range $tier, $s := groupBy "tier" .Services }}{{ $tier }}:{{ len $s }} {{ end }}`, "backend:2 frontend:1 "},
+		{"first last rest", `{{ first .Tags }} {{ last .Tags }} {{ rest .Tags }}`, "b c [a b c]"},
+		{"first of empty list", `{{ first (list) }}`, "<no value>"},
+		{"until", `{{ until 3 }}`, "[0 1 2]"},
+		{"seq", `{{ seq 2 5 }} {{ seq 3 3 }} {{ seq 3 }} {{ seq 3 1 }} {{ seq 0 5 12 }} {{ seq 3 1 2 }}`, "[2 3 4 5] [3] [1 2 3] [3 2 1] [0 5 10] []"},
+		{"add", `{{ add 1 2 3 }}`, "6"},
+		{"add with floats", `{{ add 1 0.5 }}`, "1.5"},
+		{"sub and mul", `{{ sub 10 4 }} {{ mul 2 3 4 }}`, "6 24"},
+		{"div and mod", `{{ div 7 2 }} {{ mod 7 2 }} {{ div 7.0 2 }}`, "3 1 3.5"},
+		{"max and min", `{{ max 3 9 4 }} {{ min 3 9 4 }}`, "9 3"},
+		{"math on data", `{{ range .Services }}{{ add .port 1 }} {{ end }}`, "8081 444 5433 "},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			output, err := execFuncTemplate(t, tc.template, data)
+			if err != nil {
+				t.Fatalf("Template failed: %v", err)
+			}
+			if output != tc.expected {
+				t.Errorf("Expected %q, got %q", tc.expected, output)
+			}
+		})
+	}
+}
+
+func TestCollectionFuncsErrors(t *testing.T) {
+	testCases := []struct {
+		name     string
+		template string
+	}{
+		{"dict with odd arguments", `{{ dict "a" }}`},
+		{"keys of a list", `{{ keys (list 1) }}`},
+		{"sortBy on scalars", `{{ sortBy "name" (list 2 1) }}`},
+		{"division by zero", `{{ div 1 0 }}`},
+		{"modulo by zero", `{{ mod 1 0 }}`},
+		{"math on a string", `{{ add 1 "x" }}`},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := execFuncTemplate(t, tc.template, nil); err == nil {
+				t.Error("Expected template execution to fail")
+			}
+		})
+	}
+}
@@ -0,0 +1,135 @@
+package template
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// inflectionRule rewrites the end of a lower case word
+type inflectionRule struct {
+	pattern     *regexp.Regexp
+	replacement string
+}
+
+// newRules compiles pairs of suffix patterns and replacements, in priority order
+func newRules(pairs ...string) []inflectionRule {
+	rules := make([]inflectionRule, 0, len(pairs)/2)
+	for i := 0; i+1 < len(pairs); i += 2 {
+		rules = append(rules, inflectionRule{regexp.MustCompile(pairs[i]), pairs[i+1]})
+	}
+	return rules
+}
+
+// irregularPlurals maps singular words that don't follow the suffix rules to their plural
+var irregularPlurals = map[string]string{
+	"child":  "children",
+	"foot":   "feet",
+	"goose":  "geese",
+	"man":    "men",
+	"mouse":  "mice",
+	"movie":  "movies",
+	"ox":     "oxen",
+	"person": "people",
+	"tooth":  "teeth",
+	"woman":  "women",
+}
+
+// irregularSingulars is the reverse of irregularPlurals
+var irregularSingulars = func() map[string]string {
+	singulars := make(map[string]string, len(irregularPlurals))
+	for singular, plural := range irregularPlurals {
+		singulars[plural] = singular
+	}
+	return singulars
+}()
+
+// uncountables have the same singular and plural form
+var uncountables = map[string]bool{
+	"data": true, "deer": true, "equipment": true, "fish": true, "information": true,
+	"metadata": true, "money": true, "news": true, "rice": true, "series": true,
+	"sheep": true, "species": true,
+}
+
+// pluralRules turn a singular word into its plural; the first matching rule wins
+var pluralRules = newRules(
+	`(quiz)$`, "${1}zes",
+	`(matr|vert|ind)(?:ix|ex)$`, "${1}ices",
+	`(kni|wi|li)fe$`, "${1}ves",
+	`(shel|hal|wol|cal|lea|loa|thie|sel)f$`, "${1}ves",
+	`(analy|ba|diagno|parenthe|progno|synop|the)sis$`, "${1}ses",
+	`(tomat|potat|her|ech)o$`, "${1}oes",
+	`([^aeiouy]|qu)y$`, "${1}ies",
+	`(x|ch|ss|sh|s|z)$`, "${1}es",
+	`$`, "s",
+)
+
+// singularRules turn a plural word into its singular; the first matching rule wins
+var singularRules = newRules(
+	`(quiz)zes$`, "${1}",
+	`(matr)ices$`, "${1}ix",
+	`(vert|ind)ices$`, "${1}ex",
+	`(kni|wi|li)ves$`, "${1}fe",
+	`(shel|hal|wol|cal|lea|loa|thie|sel)ves$`, "${1}f",
+	`(analy|ba|diagno|parenthe|progno|synop|the)ses$`, "${1}sis",
+	`(tomat|potat|her|ech)oes$`, "${1}o",
+	`([^aeiouy]|qu)ies$`, "${1}y",
+	`(alias|status|bus|campus|virus)es$`, "${1}",
+	`(x|ch|ss|sh|z)es$`, "${1}",
+	`(alias|status|bus|campus|virus|ss)$`, "${1}",
+	`s$`, "",
+)
+
+// pluralize returns the English plural of the last word of s, keeping the rest of s as is
+// ("UserAccount" -> "UserAccounts", "category" -> "categories")
+func pluralize(s string) string {
+	return inflect(s, irregularPlurals, pluralRules)
+}
+
+// singularize returns the English singular of the last word of s, keeping the rest of s as is
+// ("user_accounts" -> "user_account", "People" -> "Person")
+func singularize(s string) string {
+	return inflect(s, irregularSingulars, singularRules)
+}
+
+// inflect applies the irregular forms or the first matching rule to the last word of s
+// and restores the case of the original word
+func inflect(s string, irregular map[string]string, rules []inflectionRule) string {
+	words := splitWords(s)
+	if len(words) == 0 {
+		return s
+	}
+	last := words[len(words)-1]
+	idx := strings.LastIndex(s, last)
+	prefix, suffix := s[:idx], s[idx+len(last):]
+
+	lower := strings.ToLower(last)
+	if uncountables[lower] {
+		return s
+	}
+
+	inflected, ok := irregular[lower]
+	if !ok {
+		inflected = lower
+		for _, rule := range rules {
+			if rule.pattern.MatchString(lower) {
+				inflected = rule.pattern.ReplaceAllString(lower, rule.replacement)
+				break
+			}
+		}
+	}
+
+	return prefix + matchCase(last, inflected) + suffix
+}
+
+// matchCase applies the case pattern of word to inflected: all caps, capitalized or unchanged
+func matchCase(word, inflected string) string {
+	if strings.ToUpper(word) == word && strings.ToLower(word) != word {
+		return strings.ToUpper(inflected)
+	}
+	if first, _ := utf8.DecodeRuneInString(word); unicode.IsUpper(first) {
+		return capitalize(inflected)
+	}
+	return inflected
+}
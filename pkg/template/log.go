@@ -0,0 +1,21 @@
+package template
+
+import (
+	"fmt"
+	"io"
+	"os"
+)
+
+// logOutput receives the progress messages and warnings written while processing templates
+var logOutput io.Writer = os.Stdout
+
+// SetLogOutput sets where progress messages and warnings are written, so they can be kept
+// apart from output printed to stdout
+func SetLogOutput(w io.Writer) {
+	logOutput = w
+}
+
+// logf writes a progress message or warning
+func logf(format string, args ...interface{}) {
+	fmt.Fprintf(logOutput, format, args...)
+}
@@ -0,0 +1,338 @@
+package template
+
+import (
+	"bytes"
+	"encoding/json"
+	"iter"
+	"reflect"
+	"sort"
+	"sync"
+	"text/template"
+	"text/template/parse"
+	"unsafe"
+
+	"github.com/Samet-MohamedAmin/gotmpl/pkg/config"
+	"gopkg.in/yaml.v3"
+)
+
+// Functions appended to the pipeline of range actions when DataOrder is preserve. They
+// turn maps into iterators following the data file order.
+const (
+	orderedValuesFunc = "_orderedValues"
+	orderedPairsFunc  = "_orderedPairs"
+)
+
+// preserveOrder reports whether maps are ranged over in data file order
+func preserveOrder() bool {
+	return config.DataOrder == config.DataOrderPreserve
+}
+
+// mapOrders holds the key order of the data maps when DataOrder is preserve. Data maps stay
+// Go maps, so templates can use their keys as fields and with index, and the order of each
+// one is kept here, by map: the decoders record it, and copies and merges carry it over to
+// the maps they build. The maps are kept alive with their order, so an entry can't be
+// taken over by a later map.
+var mapOrders = struct {
+	sync.Mutex
+	keys map[unsafe.Pointer][]string
+}{keys: make(map[unsafe.Pointer][]string)}
+
+// setKeyOrder records the key order of a map
+func setKeyOrder(m map[string]interface{}, keys []string) {
+	if !preserveOrder() || m == nil {
+		return
+	}
+	mapOrders.Lock()
+	defer mapOrders.Unlock()
+	mapOrders.keys[reflect.ValueOf(m).UnsafePointer()] = append([]string(nil), keys...)
+}
+
+// setKey sets a key of a map, adding it after the keys the map already has when it is new
+func setKey(m map[string]interface{}, key string, value interface{}) {
+	_, exists := m[key]
+	m[key] = value
+	if exists || !preserveOrder() {
+		return
+	}
+	mapOrders.Lock()
+	defer mapOrders.Unlock()
+	id := reflect.ValueOf(m).UnsafePointer()
+	mapOrders.keys[id] = append(mapOrders.keys[id], key)
+}
+
+// orderedKeys returns the keys of a map. When DataOrder is preserve, they come in their
+// recorded order, and keys set without it, such as by templates, come last in alphabetical
+// order. Otherwise they are sorted.
+func orderedKeys(m map[string]interface{}) []string {
+	var order []string
+	if preserveOrder() && m != nil {
+		mapOrders.Lock()
+		order = mapOrders.keys[reflect.ValueOf(m).UnsafePointer()]
+		mapOrders.Unlock()
+	}
+
+	keys := make([]string, 0, len(m))
+	seen := make(map[string]bool, len(m))
+	for _, key := range order {
+		if _, exists := m[key]; exists && !seen[key] {
+			keys = append(keys, key)
+			seen[key] = true
+		}
+	}
+	rest := make([]string, 0, len(m)-len(keys))
+	for key := range m {
+		if !seen[key] {
+			rest = append(rest, key)
+		}
+	}
+	sort.Strings(rest)
+	return append(keys, rest...)
+}
+
+// recordOrder records the key order of the maps of a value decoded from a YAML node, as
+// the keys appear in the node. Keys brought in by merge keys (<<) take the place of the
+// merge key.
+func recordOrder(node *yaml.Node, value interface{}) {
+	for node.Kind == yaml.DocumentNode && len(node.Content) == 1 || node.Kind == yaml.AliasNode && node.Alias != nil {
+		if node.Kind == yaml.AliasNode {
+			node = node.Alias
+		} else {
+			node = node.Content[0]
+		}
+	}
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		if node.Kind != yaml.MappingNode {
+			return
+		}
+		keys, items := mappingKeys(node)
+		for i, key := range keys {
+			recordOrder(items[i], v[key])
+		}
+		setKeyOrder(v, keys)
+	case []interface{}:
+		if node.Kind != yaml.SequenceNode || len(node.Content) != len(v) {
+			return
+		}
+		for i, item := range v {
+			recordOrder(node.Content[i], item)
+		}
+	}
+}
+
+// mappingKeys returns the keys of a mapping node in order, with the node holding the value
+// of each one. An explicit key wins over a merged one.
+func mappingKeys(node *yaml.Node) ([]string, []*yaml.Node) {
+	var keys []string
+	var items []*yaml.Node
+	index := make(map[string]int)
+	add := func(key string, item *yaml.Node, explicit bool) {
+		if i, exists := index[key]; exists {
+			if explicit {
+				items[i] = item
+			}
+			return
+		}
+		index[key] = len(keys)
+		keys = append(keys, key)
+		items = append(items, item)
+	}
+
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key, item := node.Content[i], node.Content[i+1]
+		if key.ShortTag() != "!!merge" {
+			add(key.Value, item, true)
+			continue
+		}
+
+		sources := []*yaml.Node{item}
+		if item.Kind == yaml.SequenceNode {
+			sources = item.Content
+		}
+		for _, source := range sources {
+			for source.Kind == yaml.AliasNode && source.Alias != nil {
+				source = source.Alias
+			}
+			if source.Kind != yaml.MappingNode {
+				continue
+			}
+			mergedKeys, mergedItems := mappingKeys(source)
+			for j, merged := range mergedKeys {
+				add(merged, mergedItems[j], false)
+			}
+		}
+	}
+	return keys, items
+}
+
+// orderedNode encodes a value as a YAML node, with the keys of its maps in the order
+// orderedKeys returns
+func orderedNode(v interface{}) (*yaml.Node, error) {
+	switch value := v.(type) {
+	case map[string]interface{}:
+		node := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+		for _, key := range orderedKeys(value) {
+			keyNode := &yaml.Node{}
+			if err := keyNode.Encode(key); err != nil {
+				return nil, err
+			}
+			item, err := orderedNode(value[key])
+			if err != nil {
+				return nil, err
+			}
+			node.Content = append(node.Content, keyNode, item)
+		}
+		return node, nil
+	case []interface{}:
+		node := &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq"}
+		for _, item := range value {
+			itemNode, err := orderedNode(item)
+			if err != nil {
+				return nil, err
+			}
+			node.Content = append(node.Content, itemNode)
+		}
+		return node, nil
+	default:
+		node := &yaml.Node{}
+		if err := node.Encode(v); err != nil {
+			return nil, err
+		}
+		return node, nil
+	}
+}
+
+// orderedObject is a JSON object written with its keys in order
+type orderedObject struct {
+	keys   []string
+	values map[string]interface{}
+}
+
+// MarshalJSON writes the object with its keys in order
+func (o orderedObject) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, key := range o.keys {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		name, err := json.Marshal(key)
+		if err != nil {
+			return nil, err
+		}
+		value, err := json.Marshal(o.values[key])
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(name)
+		buf.WriteByte(':')
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// orderedValues returns an iterator over the values of a map in key order, for range
+// actions with at most one variable. Other values are returned unchanged.
+func orderedValues(value interface{}) interface{} {
+	m, ok := value.(map[string]interface{})
+	if !ok {
+		return value
+	}
+	keys := orderedKeys(m)
+	return iter.Seq[interface{}](func(yield func(interface{}) bool) {
+		for _, key := range keys {
+			if !yield(m[key]) {
+				return
+			}
+		}
+	})
+}
+
+// orderedPairs returns an iterator over the keys and values of a map in key order, for
+// range actions with two variables. Other values are returned unchanged.
+func orderedPairs(value interface{}) interface{} {
+	m, ok := value.(map[string]interface{})
+	if !ok {
+		return value
+	}
+	keys := orderedKeys(m)
+	return iter.Seq2[string, interface{}](func(yield func(string, interface{}) bool) {
+		for _, key := range keys {
+			if !yield(key, m[key]) {
+				return
+			}
+		}
+	})
+}
+
+// orderFuncs returns the functions used by the rewritten range actions
+func orderFuncs() template.FuncMap {
+	if !preserveOrder() {
+		return template.FuncMap{}
+	}
+	return template.FuncMap{
+		orderedValuesFunc: orderedValues,
+		orderedPairsFunc:  orderedPairs,
+	}
+}
+
+// orderRanges rewrites the range actions of every template of a set, so that they iterate
+// over maps in key order: text/template always ranges over Go maps in sorted order, so the
+// pipeline is piped into orderedValues or orderedPairs. Templates already rewritten are
+// left as is.
+func orderRanges(t *template.Template) {
+	for _, tmpl := range t.Templates() {
+		if tmpl.Tree != nil && tmpl.Tree.Root != nil {
+			orderRangesIn(tmpl.Tree, tmpl.Tree.Root)
+		}
+	}
+}
+
+// orderRangesIn rewrites the range actions below node
+func orderRangesIn(tree *parse.Tree, node parse.Node) {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		for _, child := range n.Nodes {
+			orderRangesIn(tree, child)
+		}
+	case *parse.IfNode:
+		orderBranches(tree, &n.BranchNode)
+	case *parse.WithNode:
+		orderBranches(tree, &n.BranchNode)
+	case *parse.RangeNode:
+		orderRangePipe(tree, n.Pipe)
+		orderBranches(tree, &n.BranchNode)
+	}
+}
+
+// orderBranches rewrites the range actions in both branches of an if, with or range action
+func orderBranches(tree *parse.Tree, branch *parse.BranchNode) {
+	if branch.List != nil {
+		orderRangesIn(tree, branch.List)
+	}
+	if branch.ElseList != nil {
+		orderRangesIn(tree, branch.ElseList)
+	}
+}
+
+// orderRangePipe pipes the pipeline of a range action into the function ordering maps
+func orderRangePipe(tree *parse.Tree, pipe *parse.PipeNode) {
+	if pipe == nil || len(pipe.Cmds) == 0 {
+		return
+	}
+	last := pipe.Cmds[len(pipe.Cmds)-1]
+	if ident, ok := last.Args[0].(*parse.IdentifierNode); ok &&
+		(ident.Ident == orderedValuesFunc || ident.Ident == orderedPairsFunc) {
+		return
+	}
+
+	name := orderedValuesFunc
+	if len(pipe.Decl) > 1 {
+		name = orderedPairsFunc
+	}
+	cmd := last.Copy().(*parse.CommandNode)
+	cmd.Args = []parse.Node{parse.NewIdentifier(name).SetTree(tree).SetPos(last.Pos)}
+	pipe.Cmds = append(pipe.Cmds, cmd)
+}
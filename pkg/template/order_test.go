@@ -0,0 +1,175 @@
+package template
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Samet-MohamedAmin/gotmpl/pkg/config"
+)
+
+func TestProcessTemplateDataOrder(t *testing.T) {
+	services := "services:\n  web:\n    port: 80\n  api:\n    port: 8080\n  db:\n    port: 5432\n"
+
+	testCases := []struct {
+		name     string
+		order    string
+		env      string
+		values   []ValueSource
+		files    map[string]string
+		template string
+		expected string
+	}{
+		{
+			name:     "Sorted by default",
+			order:    config.DataOrderSorted,
+			files:    map[string]string{"app/data.yaml": services},
+			template: `{{ range $k, $v := .services }}{{ $k }}:{{ $v.port }} {{ end }}`,
+			expected: "api:8080 db:5432 web:80",
+		},
+		{
+			name:     "Keys and values in file order",
+			order:    config.DataOrderPreserve,
+			files:    map[string]string{"app/data.yaml": services},
+			template: `{{ range $k, $v := .services }}{{ $k }}:{{ $v.port }} {{ end }}`,
+			expected: "web:80 api:8080 db:5432",
+		},
+		{
+			name:     "Values in file order",
+			order:    config.DataOrderPreserve,
+			files:    map[string]string{"app/data.yaml": services},
+			template: `{{ range .services }}{{ .port }} {{ end }}{{ .services.db.port }}`,
+			expected: "80 8080 5432 5432",
+		},
+		{
+			name:     "JSON data file",
+			order:    config.DataOrderPreserve,
+			files:    map[string]string{"app/data.json": `{"z": 1, "m": {"b": [{"y": 1.5, "x": 2}], "a": null}}`},
+			template: `{{ range $k, $_ := . }}{{ $k }}{{ end }} {{ range $k, $_ := .m }}{{ $k }}{{ end }} {{ range index .m.b 0 }}{{ . }} {{ end }}`,
+			expected: "zm ba 1.5 2",
+		},
+		{
+			name:  "Nested maps, lists and partials",
+			order: config.DataOrderPreserve,
+			files: map[string]string{
+				"app/data.yaml": "z: 1\nitems:\n  - b: 1\n    a: 2\nm: {y: 1, x: 2}\n",
+			},
+			template: `{{ define "keys" }}{{ range $k, $_ := . }}{{ $k }}{{ end }}{{ end }}` +
+				`{{ template "keys" . }} {{ range .items }}{{ template "keys" . }}{{ end }} {{ with .m }}{{ range $k, $v := . }}{{ $k }}{{ end }}{{ end }}`,
+			expected: "zitemsm ba yx",
+		},
+		{
+			name:  "Inherited keys first",
+			order: config.DataOrderPreserve,
+			files: map[string]string{
+				"data.yaml":     "labels:\n  team: core\n  tier: web\n",
+				"app/data.yaml": "labels:\n  app: shop\n  team: ops\n",
+			},
+			template: `{{ range $k, $v := .labels }}{{ $k }}={{ $v }} {{ end }}`,
+			expected: "team=ops tier=web app=shop",
+		},
+		{
+			name:     "Lists, empty maps and tpl",
+			order:    config.DataOrderPreserve,
+			files:    map[string]string{"app/data.yaml": "list: [c, a]\nempty: {}\nm: {b: 1, a: 2}\n"},
+			template: `{{ range $i, $v := .list }}{{ $i }}{{ $v }}{{ end }} {{ range .empty }}x{{ else }}none{{ end }} {{ tpl "{{ range $k, $_ := .m }}{{ $k }}{{ end }}" . }}`,
+			expected: "0c1a none ba",
+		},
+		{
+			name:  "Overlay, values and schema defaults",
+			order: config.DataOrderPreserve,
+			env:   "prod",
+			values: []ValueSource{
+				{Flag: ValuesFlag, Value: "values.yaml"},
+				{Flag: SetFlag, Value: "y.b=1,y.a=2,b=3"},
+			},
+			files: map[string]string{
+				"app/data.yaml":      "m: {b: 1}\nb: 1\na: 2\n",
+				"app/data.prod.yaml": "x: 1\nm: {a: 2}\nw: 2\n",
+				"app/values.yaml":    "v: 1\nm: {c: 3}\n",
+				"app/schema.yaml":    "properties:\n  s: {default: 1}\n  d: {default: 2}\n",
+			},
+			template: `{{ range $k, $_ := . }}{{ $k }}{{ end }} {{ range $k, $_ := .m }}{{ $k }}{{ end }} {{ range $k, $_ := .y }}{{ $k }}{{ end }}`,
+			expected: "mbaxwvyds bac ba",
+		},
+		{
+			name:  "Merge keys and included JSON",
+			order: config.DataOrderPreserve,
+			files: map[string]string{
+				"app/data.yaml":  "base: &base {y: 1, x: 2}\nm:\n  <<: *base\n  w: 3\n  x: 4\ninc: !include other.json\n",
+				"app/other.json": `{"k": 1, "b": 2}`,
+			},
+			template: `{{ range $k, $v := .m }}{{ $k }}={{ $v }} {{ end }}{{ range $k, $_ := .inc }}{{ $k }}{{ end }}`,
+			expected: "y=1 x=4 w=3 kb",
+		},
+		{
+			name:  "Maps built by template functions",
+			order: config.DataOrderPreserve,
+			files: map[string]string{"app/data.yaml": "m: {z: 1, b: 2, a: 3}\n"},
+			template: `{{ $d := dict "b" 1 "a" 2 }}{{ range $k, $_ := $d }}{{ $k }}{{ end }} ` +
+				`{{ range $k, $_ := merge $d (dict "z" 0 "c" 3) }}{{ $k }}{{ end }} ` +
+				`{{ range $k, $_ := pick .m "a" "z" }}{{ $k }}{{ end }} ` +
+				`{{ range $k, $_ := omit .m "b" }}{{ $k }}{{ end }} ` +
+				`{{ range $k, $_ := fromYaml "q: 1\np: 2" }}{{ $k }}{{ end }} ` +
+				`{{ range $k, $_ := fromJson "{\"q\": 1, \"p\": 2}" }}{{ $k }}{{ end }} ` +
+				`{{ .m.b }} {{ index .m "z" }}`,
+			expected: "ba bazc za za qp qp 2 1",
+		},
+		{
+			name:     "Serialized in order",
+			order:    config.DataOrderPreserve,
+			files:    map[string]string{"app/data.yaml": "m: {z: 1, a: {c: 1, b: [2]}}\n"},
+			template: "{{ toJson .m }}\n{{ toYaml .m }}\n{{ toJson (dict \"b\" 1 \"a\" 2) }}",
+			expected: "{\"z\":1,\"a\":{\"c\":1,\"b\":[2]}}\nz: 1\na:\n  c: 1\n  b:\n    - 2\n{\"b\":1,\"a\":2}",
+		},
+		{
+			name:     "Serialized sorted by default",
+			order:    config.DataOrderSorted,
+			files:    map[string]string{"app/data.yaml": "m: {z: 1, a: {c: 1, b: [2]}}\n"},
+			template: "{{ toJson .m }}\n{{ toYaml .m }}",
+			expected: "{\"a\":{\"b\":[2],\"c\":1},\"z\":1}\na:\n  b:\n    - 2\n  c: 1\nz: 1",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			srcDir := t.TempDir()
+			config.Reset()
+			config.OutputDir = t.TempDir()
+			config.DataOrder = tc.order
+			defer config.Reset()
+
+			files := map[string]string{"app/template.go.tmpl": tc.template}
+			for name, content := range tc.files {
+				files[name] = content
+			}
+			writeFiles(t, srcDir, files)
+
+			processor := NewProcessor(false)
+			processor.SetSourceRoot(srcDir)
+			processor.SetEnvironment(tc.env)
+			if tc.values != nil {
+				for i := range tc.values {
+					if tc.values[i].Flag == ValuesFlag {
+						tc.values[i].Value = filepath.Join(srcDir, "app", tc.values[i].Value)
+					}
+				}
+				if err := processor.LoadValues(tc.values); err != nil {
+					t.Fatalf("LoadValues failed: %v", err)
+				}
+			}
+			if err := processor.ProcessTemplate(filepath.Join(srcDir, "app", config.TemplateFile), true); err != nil {
+				t.Fatalf("ProcessTemplate failed: %v", err)
+			}
+
+			content, err := os.ReadFile(filepath.Join(config.OutputDir, "app", config.DefaultPrefix))
+			if err != nil {
+				t.Fatalf("Failed to read output: %v", err)
+			}
+			if strings.TrimSpace(string(content)) != tc.expected {
+				t.Errorf("Expected output %q, got %q", tc.expected, content)
+			}
+		})
+	}
+}
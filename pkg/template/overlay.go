@@ -0,0 +1,168 @@
+package template
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/Samet-MohamedAmin/gotmpl/pkg/config"
+)
+
+// AllEnvironments selects every environment overlay found next to the data files
+const AllEnvironments = "all"
+
+// ValidEnvironment checks an environment name. It becomes part of file and directory names,
+// so it can't be empty or contain dots or path separators.
+func ValidEnvironment(env string) error {
+	if env == "" {
+		return errors.New("environment name is empty")
+	}
+	if strings.ContainsAny(env, `./\`) {
+		return fmt.Errorf("invalid environment name %q: it can't contain dots or path separators", env)
+	}
+	return nil
+}
+
+// dataFileStem splits DataFile into the stem overlays are named after and its extension.
+// The extension is empty when it selects a decoder, since overlays may use any format then.
+func dataFileStem() (string, string) {
+	ext := filepath.Ext(config.DataFile)
+	stem := strings.TrimSuffix(config.DataFile, ext)
+	if supportedDataExtension(ext) {
+		return stem, ""
+	}
+	return stem, ext
+}
+
+// overlayCandidates returns the overlay file names of an environment: the data file stem
+// followed by the environment, so data.yaml has the overlays data.prod.yaml, data.prod.json
+// and so on
+func overlayCandidates(env string) []string {
+	stem, ext := dataFileStem()
+	if ext != "" {
+		return []string{stem + "." + env + ext}
+	}
+	candidates := make([]string, len(dataExtensions))
+	for i, candidate := range dataExtensions {
+		candidates[i] = stem + "." + env + candidate
+	}
+	return candidates
+}
+
+// overlayEnvironment returns the environment of an overlay file name, or "" when the name
+// isn't an overlay of the data file
+func overlayEnvironment(name string) string {
+	stem, ext := dataFileStem()
+	nameExt := filepath.Ext(name)
+	if ext != "" && nameExt != ext || ext == "" && !supportedDataExtension(nameExt) {
+		return ""
+	}
+	env, ok := strings.CutPrefix(strings.TrimSuffix(name, nameExt), stem+".")
+	if !ok || ValidEnvironment(env) != nil {
+		return ""
+	}
+	return env
+}
+
+// SetEnvironment sets the environment whose overlays are merged over the data files. An
+// empty environment disables overlays.
+func (p *TemplateProcessor) SetEnvironment(env string) {
+	p.environment = env
+}
+
+// loadOverlay loads the overlay of the current environment in a directory. It returns nil
+// when no environment is set or the directory has no overlay for it.
+func (p *TemplateProcessor) loadOverlay(dir string) (map[string]interface{}, error) {
+	if p.environment == "" {
+		return nil, nil
+	}
+
+	overlayPath, err := findOneOf(dir, "overlay", overlayCandidates(p.environment))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	logf("Using overlay file: %s\n", overlayPath)
+
+	data, err := p.loadData(overlayPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load overlay: %w", err)
+	}
+	switch values := data.(type) {
+	case nil:
+		return map[string]interface{}{}, nil
+	case map[string]interface{}:
+		return values, nil
+	default:
+		return nil, fmt.Errorf("overlay file %s is not a mapping", overlayPath)
+	}
+}
+
+// CheckEnvironment fails when none of the given templates has an overlay for env, in its own
+// directory or in the directories it inherits data from, so a misspelled environment isn't
+// silently rendered with the base data
+func (p *TemplateProcessor) CheckEnvironment(env string, templateFiles []string, multiple bool) error {
+	environments, err := p.Environments(templateFiles, multiple)
+	if err != nil {
+		return err
+	}
+	if slices.Contains(environments, env) {
+		return nil
+	}
+
+	stem, _ := dataFileStem()
+	if len(environments) == 0 {
+		return fmt.Errorf("no %s.%s overlay found next to the data files, and no other environment either", stem, env)
+	}
+	return fmt.Errorf("no %s.%s overlay found next to the data files; environments with overlays: %s",
+		stem, env, strings.Join(environments, ", "))
+}
+
+// Environments returns the environments that have an overlay next to the data of the given
+// templates, in their own directories or, in multiple mode, in the directories they inherit
+// data from. The list is sorted.
+func (p *TemplateProcessor) Environments(templateFiles []string, multiple bool) ([]string, error) {
+	seen := make(map[string]bool)
+	scanned := make(map[string]bool)
+
+	for _, templatePath := range templateFiles {
+		dirs, err := p.templateAncestors(templatePath, multiple)
+		if err != nil {
+			return nil, err
+		}
+		dirs = append(dirs, filepath.Dir(templatePath))
+
+		for _, dir := range dirs {
+			if scanned[dir] {
+				continue
+			}
+			scanned[dir] = true
+
+			entries, err := os.ReadDir(dir)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read directory: %w", err)
+			}
+			for _, entry := range entries {
+				if entry.IsDir() {
+					continue
+				}
+				if env := overlayEnvironment(entry.Name()); env != "" {
+					seen[env] = true
+				}
+			}
+		}
+	}
+
+	environments := make([]string, 0, len(seen))
+	for env := range seen {
+		environments = append(environments, env)
+	}
+	sort.Strings(environments)
+	return environments, nil
+}
@@ -0,0 +1,119 @@
+package template
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"text/template"
+	"text/template/parse"
+
+	"github.com/Samet-MohamedAmin/gotmpl/pkg/config"
+)
+
+// partialPattern matches partial files picked up from the source root and template directories
+const partialPattern = "_*.tmpl"
+
+// findPartials returns the partial files available to a template in load order:
+// every .tmpl file in PartialsDir, then _*.tmpl files in the source root and in the template's directory.
+// A relative PartialsDir is resolved against the source root.
+func (p *TemplateProcessor) findPartials(templatePath string) ([]string, error) {
+	var partials []string
+	seen := make(map[string]bool)
+
+	addMatches := func(pattern string) error {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return fmt.Errorf("invalid partial pattern %s: %w", pattern, err)
+		}
+		sort.Strings(matches)
+
+		for _, match := range matches {
+			absPath, err := filepath.Abs(match)
+			if err != nil {
+				return fmt.Errorf("failed to get absolute path for partial %s: %w", match, err)
+			}
+			// Skip the template itself and files already found in another location
+			if seen[absPath] || filepath.Base(match) == config.TemplateFile {
+				continue
+			}
+			seen[absPath] = true
+			partials = append(partials, match)
+		}
+		return nil
+	}
+
+	if config.PartialsDir != "" {
+		partialsDir := config.PartialsDir
+		if !filepath.IsAbs(partialsDir) {
+			partialsDir = filepath.Join(p.rootDir(templatePath), partialsDir)
+		}
+		info, err := os.Stat(partialsDir)
+		if err != nil {
+			return nil, fmt.Errorf("partials directory not found: %w", err)
+		}
+		if !info.IsDir() {
+			return nil, fmt.Errorf("partials path is not a directory: %s", partialsDir)
+		}
+		// A template file there would be loaded as a partial, which is almost certainly a mistake
+		if _, err := os.Stat(filepath.Join(partialsDir, config.TemplateFile)); err == nil {
+			return nil, fmt.Errorf("partials directory %s contains a template file %s; rename it or move it to a template directory",
+				partialsDir, config.TemplateFile)
+		}
+		if err := addMatches(filepath.Join(partialsDir, "*.tmpl")); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := addMatches(filepath.Join(p.rootDir(templatePath), partialPattern)); err != nil {
+		return nil, err
+	}
+	if err := addMatches(filepath.Join(filepath.Dir(templatePath), partialPattern)); err != nil {
+		return nil, err
+	}
+
+	return partials, nil
+}
+
+// addPartials parses every partial file and adds its definitions to the template set.
+// Each file is parsed on its own so that a name defined by two partials can be reported
+// with both file paths instead of one silently replacing the other. Partials are shared by
+// every template, so they use the LeftDelim and RightDelim settings rather than the
+// delimiters of the template's config directive.
+func (p *TemplateProcessor) addPartials(set *templateSet, parsed *template.Template, partials []string, funcs template.FuncMap) error {
+	definedIn := make(map[string]string)
+
+	for _, partialPath := range partials {
+		content, err := os.ReadFile(partialPath)
+		if err != nil {
+			return fmt.Errorf("failed to read partial: %w", err)
+		}
+
+		partial, err := template.New(filepath.Base(partialPath)).
+			Delims(config.LeftDelim, config.RightDelim).
+			Funcs(funcs).
+			Option(p.templateOptions()...).
+			Parse(string(content))
+		if err != nil {
+			return fmt.Errorf("failed to parse partial: %w", err)
+		}
+		set.files[partial.Name()] = partialPath
+
+		for _, t := range partial.Templates() {
+			// Files that only hold {{define}} blocks leave an empty top-level template behind
+			if t.Tree == nil || parse.IsEmptyTree(t.Tree.Root) {
+				continue
+			}
+			if previous, ok := definedIn[t.Name()]; ok {
+				return fmt.Errorf("template %q is defined in both %s and %s", t.Name(), previous, partialPath)
+			}
+			definedIn[t.Name()] = partialPath
+
+			if _, err := parsed.AddParseTree(t.Name(), t.Tree); err != nil {
+				return fmt.Errorf("failed to add partial %q from %s: %w", t.Name(), partialPath, err)
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,252 @@
+package template
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/Samet-MohamedAmin/gotmpl/pkg/config"
+)
+
+// Plugins speak line-delimited JSON. On start a plugin writes a pluginHello line listing its
+// functions, then answers every pluginRequest read from stdin with one pluginResponse line.
+
+// pluginHello is the first message sent by a plugin
+type pluginHello struct {
+	Functions []string `json:"functions"`
+}
+
+// pluginRequest asks a plugin to call one of its functions
+type pluginRequest struct {
+	ID       int           `json:"id"`
+	Function string        `json:"function"`
+	Args     []interface{} `json:"args"`
+}
+
+// pluginResponse is the answer to a pluginRequest
+type pluginResponse struct {
+	ID     int         `json:"id"`
+	Result interface{} `json:"result"`
+	Error  string      `json:"error"`
+}
+
+// templateBuiltins are the functions predefined by text/template, which plugins can't replace
+var templateBuiltins = map[string]bool{
+	"and": true, "call": true, "html": true, "index": true, "slice": true, "js": true,
+	"len": true, "not": true, "or": true, "print": true, "printf": true, "println": true,
+	"urlquery": true, "eq": true, "ge": true, "gt": true, "le": true, "lt": true, "ne": true,
+}
+
+// pluginTimeout bounds the wait for each line a plugin writes. A plugin that doesn't answer
+// in time is killed.
+var pluginTimeout = 30 * time.Second
+
+// plugin is a running plugin process
+type plugin struct {
+	name      string
+	cmd       *exec.Cmd
+	stdin     io.WriteCloser
+	stdout    *bufio.Reader
+	functions []string
+
+	mu     sync.Mutex
+	nextID int
+	err    error
+}
+
+// startPlugin starts a plugin and reads the functions it announces
+func startPlugin(declared config.Plugin) (*plugin, error) {
+	name := declared.Name
+	if name == "" {
+		name = declared.Command
+	}
+
+	cmd := exec.Command(declared.Command, declared.Args...)
+	cmd.Stderr = os.Stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, fmt.Errorf("plugin %s: %w", name, err)
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, fmt.Errorf("plugin %s: %w", name, err)
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start plugin %s: %w", name, err)
+	}
+
+	p := &plugin{name: name, cmd: cmd, stdin: stdin, stdout: bufio.NewReader(stdout)}
+
+	var hello pluginHello
+	if err := p.read(&hello); err != nil {
+		p.close()
+		return nil, fmt.Errorf("plugin %s did not announce its functions: %w", name, err)
+	}
+	for _, function := range hello.Functions {
+		if !config.ValidFunctionName(function) {
+			p.close()
+			return nil, fmt.Errorf("plugin %s announced an invalid function name %q", name, function)
+		}
+	}
+	p.functions = hello.Functions
+	return p, nil
+}
+
+// pluginLine is a line read from a plugin, with the error that ended it
+type pluginLine struct {
+	line []byte
+	err  error
+}
+
+// read decodes the next line written by the plugin. The plugin is killed when the line
+// doesn't come within pluginTimeout.
+func (p *plugin) read(v interface{}) error {
+	lines := make(chan pluginLine, 1)
+	go func() {
+		line, err := p.stdout.ReadBytes('\n')
+		lines <- pluginLine{line, err}
+	}()
+
+	var line []byte
+	var err error
+	select {
+	case read := <-lines:
+		line, err = read.line, read.err
+	case <-time.After(pluginTimeout):
+		p.cmd.Process.Kill()
+		return fmt.Errorf("no answer within %s, plugin killed", pluginTimeout)
+	}
+	if len(bytes.TrimSpace(line)) == 0 && err != nil {
+		if err == io.EOF {
+			return fmt.Errorf("plugin exited")
+		}
+		return err
+	}
+	if err := json.Unmarshal(line, v); err != nil {
+		return fmt.Errorf("invalid message %q: %w", bytes.TrimSpace(line), err)
+	}
+	return nil
+}
+
+// call forwards a function call to the plugin and waits for its result
+func (p *plugin) call(function string, args []interface{}) (interface{}, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	// A broken connection can't be recovered, so later calls fail with the same error
+	if p.err != nil {
+		return nil, p.err
+	}
+
+	p.nextID++
+	request := pluginRequest{ID: p.nextID, Function: function, Args: make([]interface{}, len(args))}
+	for i, arg := range args {
+		request.Args[i] = jsonCompatible(arg)
+	}
+	line, err := json.Marshal(request)
+	if err != nil {
+		return nil, fmt.Errorf("plugin %s: failed to encode request: %w", p.name, err)
+	}
+	if _, err := p.stdin.Write(append(line, '\n')); err != nil {
+		p.err = fmt.Errorf("plugin %s: failed to send request: %w", p.name, err)
+		return nil, p.err
+	}
+
+	var response pluginResponse
+	if err := p.read(&response); err != nil {
+		p.err = fmt.Errorf("plugin %s: %w", p.name, err)
+		return nil, p.err
+	}
+	if response.ID != request.ID {
+		p.err = fmt.Errorf("plugin %s: expected response %d, got %d", p.name, request.ID, response.ID)
+		return nil, p.err
+	}
+	if response.Error != "" {
+		return nil, fmt.Errorf("plugin %s: %s", p.name, response.Error)
+	}
+	return response.Result, nil
+}
+
+// close stops the plugin by closing its input and waits for it to exit. The plugin is killed
+// when it doesn't exit within pluginTimeout.
+func (p *plugin) close() error {
+	p.stdin.Close()
+	exited := make(chan error, 1)
+	go func() {
+		exited <- p.cmd.Wait()
+	}()
+
+	select {
+	case err := <-exited:
+		if err != nil {
+			return fmt.Errorf("plugin %s: %w", p.name, err)
+		}
+		return nil
+	case <-time.After(pluginTimeout):
+		p.cmd.Process.Kill()
+		<-exited
+		return fmt.Errorf("plugin %s: did not exit within %s after its input was closed, plugin killed", p.name, pluginTimeout)
+	}
+}
+
+// pluginSet holds the plugins of a run and the functions they provide
+type pluginSet struct {
+	plugins []*plugin
+	funcs   template.FuncMap
+}
+
+// startPlugins starts every declared plugin. A function may only be provided once, and
+// plugins can't replace the built-in functions.
+func startPlugins(declared []config.Plugin, builtins template.FuncMap) (*pluginSet, error) {
+	set := &pluginSet{funcs: template.FuncMap{}}
+	owners := make(map[string]string)
+
+	for _, d := range declared {
+		p, err := startPlugin(d)
+		if err != nil {
+			set.close()
+			return nil, err
+		}
+		set.plugins = append(set.plugins, p)
+
+		for _, function := range p.functions {
+			if _, exists := builtins[function]; exists || templateBuiltins[function] {
+				set.close()
+				return nil, fmt.Errorf("plugin %s: function %q is already a built-in function", p.name, function)
+			}
+			if owner, exists := owners[function]; exists {
+				set.close()
+				return nil, fmt.Errorf("function %q is provided by both plugin %s and plugin %s", function, owner, p.name)
+			}
+			owners[function] = p.name
+			set.funcs[function] = p.forward(function)
+		}
+	}
+	return set, nil
+}
+
+// forward returns a template function that calls a plugin function
+func (p *plugin) forward(function string) func(args ...interface{}) (interface{}, error) {
+	return func(args ...interface{}) (interface{}, error) {
+		return p.call(function, args)
+	}
+}
+
+// close stops every plugin and returns the first error
+func (s *pluginSet) close() error {
+	var closeErr error
+	for _, p := range s.plugins {
+		if err := p.close(); err != nil && closeErr == nil {
+			closeErr = err
+		}
+	}
+	s.plugins = nil
+	return closeErr
+}
@@ -0,0 +1,220 @@
+package template
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Samet-MohamedAmin/gotmpl/pkg/config"
+)
+
+// TestPluginHelperProcess is not a real test. It is started by the plugin tests as a plugin
+// executable, behaving according to the mode given after "--".
+func TestPluginHelperProcess(t *testing.T) {
+	if os.Getenv("GOTMPL_TEST_PLUGIN") != "1" {
+		return
+	}
+	defer os.Exit(0)
+
+	mode := os.Args[len(os.Args)-1]
+	switch mode {
+	case "crash":
+		os.Exit(3)
+	case "silent":
+		io.Copy(io.Discard, os.Stdin)
+		return
+	case "mute":
+		fmt.Println(`{"functions":["servicePort"]}`)
+		io.Copy(io.Discard, os.Stdin)
+		return
+	case "stubborn":
+		fmt.Println(`{"functions":["servicePort"]}`)
+		io.Copy(io.Discard, os.Stdin)
+		time.Sleep(time.Minute)
+		return
+	case "builtin":
+		fmt.Println(`{"functions":["upper"]}`)
+	default:
+		fmt.Println(`{"functions":["servicePort","echo"]}`)
+	}
+
+	ports := map[string]int{"web": 8080, "api": 9090}
+	scanner := bufio.NewScanner(os.Stdin)
+	for scanner.Scan() {
+		var request pluginRequest
+		if err := json.Unmarshal(scanner.Bytes(), &request); err != nil {
+			os.Exit(2)
+		}
+		response := pluginResponse{ID: request.ID}
+		switch request.Function {
+		case "servicePort":
+			name := fmt.Sprint(request.Args[0])
+			if port, ok := ports[name]; ok {
+				response.Result = port
+			} else {
+				response.Error = fmt.Sprintf("unknown service %q", name)
+			}
+		case "echo":
+			response.Result = request.Args
+		}
+		out, _ := json.Marshal(response)
+		fmt.Println(string(out))
+	}
+}
+
+// helperPlugin declares the test binary as a plugin running in the given mode
+func helperPlugin(t *testing.T, mode string) config.Plugin {
+	t.Helper()
+	t.Setenv("GOTMPL_TEST_PLUGIN", "1")
+	return config.Plugin{
+		Name:    mode,
+		Command: os.Args[0],
+		Args:    []string{"-test.run=^TestPluginHelperProcess$", "--", mode},
+	}
+}
+
+func TestProcessTemplatePlugins(t *testing.T) {
+	defer func(timeout time.Duration) { pluginTimeout = timeout }(pluginTimeout)
+	pluginTimeout = time.Second
+
+	testCases := []struct {
+		name     string
+		mode     string
+		template string
+		expected string
+		errorMsg string
+	}{
+		{
+			name:     "Plugin function",
+			mode:     "catalog",
+			template: `port: {{ servicePort .Name }}`,
+			expected: "port: 8080",
+		},
+		{
+			name:     "Structured arguments",
+			mode:     "catalog",
+			template: `{{ echo .Name (dict "tier" "frontend") 3 | toJson }}`,
+			expected: `["web",{"tier":"frontend"},3]`,
+		},
+		{
+			name:     "Plugin error with template position",
+			mode:     "catalog",
+			template: "first\n{{ servicePort \"db\" }}",
+			errorMsg: `template.go.tmpl:2:3: executing "template.go.tmpl" at <servicePort "db">: error calling servicePort: plugin catalog: unknown service "db"`,
+		},
+		{
+			name:     "Plugin exits before announcing functions",
+			mode:     "crash",
+			template: `{{ .Name }}`,
+			errorMsg: "plugin crash did not announce its functions",
+		},
+		{
+			name:     "Plugin never announces its functions",
+			mode:     "silent",
+			template: `{{ .Name }}`,
+			errorMsg: "plugin silent did not announce its functions: no answer within 1s, plugin killed",
+		},
+		{
+			name:     "Plugin never answers",
+			mode:     "mute",
+			template: `{{ servicePort .Name }}`,
+			errorMsg: "error calling servicePort: plugin mute: no answer within 1s, plugin killed",
+		},
+		{
+			name:     "Plugin replacing a built-in function",
+			mode:     "builtin",
+			template: `{{ .Name }}`,
+			errorMsg: `function "upper" is already a built-in function`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			srcDir := t.TempDir()
+			config.Reset()
+			config.OutputDir = t.TempDir()
+			config.Plugins = []config.Plugin{helperPlugin(t, tc.mode)}
+			defer config.Reset()
+
+			writeFiles(t, srcDir, map[string]string{
+				"app/data.yaml":        "Name: web",
+				"app/template.go.tmpl": tc.template,
+			})
+
+			output, err := renderTemplateDir(t, srcDir, "app")
+			if tc.errorMsg != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.errorMsg) {
+					t.Errorf("Expected error containing %q, got %v", tc.errorMsg, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ProcessTemplate failed: %v", err)
+			}
+			if strings.TrimSpace(output) != tc.expected {
+				t.Errorf("Expected output %q, got %q", tc.expected, output)
+			}
+		})
+	}
+}
+
+func TestPluginStartedOncePerRun(t *testing.T) {
+	srcDir := t.TempDir()
+	config.Reset()
+	config.OutputDir = t.TempDir()
+	config.Plugins = []config.Plugin{helperPlugin(t, "catalog")}
+	defer config.Reset()
+
+	writeFiles(t, srcDir, map[string]string{
+		"web/data.yaml":        "Name: web",
+		"web/template.go.tmpl": `{{ servicePort .Name }}`,
+		"api/data.yaml":        "Name: api",
+		"api/template.go.tmpl": `{{ servicePort .Name }}`,
+	})
+
+	processor := NewProcessor(false)
+	processor.SetSourceRoot(srcDir)
+	for _, name := range []string{"web", "api"} {
+		if err := processor.ProcessTemplate(filepath.Join(srcDir, name, config.TemplateFile), true); err != nil {
+			t.Fatalf("ProcessTemplate failed: %v", err)
+		}
+	}
+	started := processor.plugins.plugins[0]
+	if started.nextID != 2 {
+		t.Errorf("Expected both calls to reach the same plugin, got %d calls", started.nextID)
+	}
+	if err := processor.Close(); err != nil {
+		t.Errorf("Expected plugin to exit cleanly, got %v", err)
+	}
+}
+
+func TestPluginKilledWhenNotExiting(t *testing.T) {
+	defer func(timeout time.Duration) { pluginTimeout = timeout }(pluginTimeout)
+	pluginTimeout = time.Second
+
+	srcDir := t.TempDir()
+	config.Reset()
+	config.OutputDir = t.TempDir()
+	config.Plugins = []config.Plugin{helperPlugin(t, "stubborn")}
+	defer config.Reset()
+
+	writeFiles(t, srcDir, map[string]string{
+		"app/data.yaml":        "Name: web",
+		"app/template.go.tmpl": `{{ .Name }}`,
+	})
+
+	processor := NewProcessor(false)
+	if err := processor.ProcessTemplate(filepath.Join(srcDir, "app", config.TemplateFile), true); err != nil {
+		t.Fatalf("ProcessTemplate failed: %v", err)
+	}
+	expected := "plugin stubborn: did not exit within 1s after its input was closed, plugin killed"
+	if err := processor.Close(); err == nil || err.Error() != expected {
+		t.Errorf("Expected error %q, got %v", expected, err)
+	}
+}
@@ -3,29 +3,43 @@ package template
 import (
 	"bufio"
 	"bytes"
+	"errors"
 	"fmt"
-	"html/template"
 	"io"
 	"os"
 	"path/filepath"
 	"strings"
+	"text/template"
+	"time"
 
 	"github.com/Samet-MohamedAmin/gotmpl/pkg/config"
-
-	"gopkg.in/yaml.v3"
 )
 
 // TemplateConfig holds configuration options for template processing
 type TemplateConfig struct {
-	Extension string
-	Separate  bool
+	Extension  string
+	Separate   bool
+	Engine     string
+	MissingKey string
+	LeftDelim  string
+	RightDelim string
+	ForeachDoc bool
+	ForeachKey string
 }
 
 // TemplateProcessor handles the processing of Go templates
 type TemplateProcessor struct {
-	defaultSeparate bool
-	config          TemplateConfig
-	configSet       bool
+	defaultSeparate    bool
+	defaultPerDocument bool
+	config             TemplateConfig
+	configSet          bool
+	sourceRoot         string
+	now                time.Time
+	plugins            *pluginSet
+	overrides          []map[string]interface{}
+	environment        string
+	// secrets holds the values decrypted from the data, masked wherever it is printed
+	secrets *secretSet
 }
 
 // NewProcessor creates a new template processor with default settings
@@ -33,13 +47,60 @@ func NewProcessor(defaultSeparate bool) *TemplateProcessor {
 	return &TemplateProcessor{
 		defaultSeparate: defaultSeparate,
 		config: TemplateConfig{
-			Extension: strings.TrimPrefix(config.OutputExtension, "."),
-			Separate:  defaultSeparate,
+			Extension:  strings.TrimPrefix(config.OutputExtension, "."),
+			Separate:   defaultSeparate,
+			Engine:     config.Engine,
+			MissingKey: config.MissingKey,
+			LeftDelim:  config.LeftDelim,
+			RightDelim: config.RightDelim,
 		},
 		configSet: false,
+		now:       time.Now(),
+		secrets:   newSecretSet(),
 	}
 }
 
+// SetSourceRoot sets the source directory passed to gen. Shared partials are looked up there;
+// when it is not set, each template's own directory is used.
+func (p *TemplateProcessor) SetSourceRoot(dir string) {
+	p.sourceRoot = dir
+}
+
+// SetPerDocument sets whether templates are rendered once per document of their data file
+// unless their config directive says otherwise
+func (p *TemplateProcessor) SetPerDocument(perDocument bool) {
+	p.defaultPerDocument = perDocument
+}
+
+// SetOverrides sets the value layers merged, in order, over the data of every template
+func (p *TemplateProcessor) SetOverrides(layers []map[string]interface{}) {
+	p.overrides = layers
+}
+
+// SetNow pins the instant returned by the template time functions. By default it is the
+// time the processor was created, so all templates of a run see the same time.
+func (p *TemplateProcessor) SetNow(now time.Time) {
+	p.now = now
+}
+
+// Close stops the plugins started by the processor
+func (p *TemplateProcessor) Close() error {
+	if p.plugins == nil {
+		return nil
+	}
+	err := p.plugins.close()
+	p.plugins = nil
+	return err
+}
+
+// rootDir returns the source root for a template
+func (p *TemplateProcessor) rootDir(templatePath string) string {
+	if p.sourceRoot == "" {
+		return filepath.Dir(templatePath)
+	}
+	return p.sourceRoot
+}
+
 // ProcessTemplate processes a single template file
 func (p *TemplateProcessor) ProcessTemplate(templatePath string, multiple bool) error {
 	// Reset configuration for each template
@@ -51,76 +112,330 @@ func (p *TemplateProcessor) ProcessTemplate(templatePath string, multiple bool)
 		return fmt.Errorf("failed to load template: %w", err)
 	}
 
-	// Get data file path based on template path
-	dataPath := p.getDataFilePath(templatePath)
-	fmt.Printf("Using data file: %s\n", dataPath)
-
-	// Load data from YAML file
-	data, err := p.loadData(dataPath)
+	// Load the data the template is rendered with
+	documents, err := p.templateDocuments(templatePath, multiple)
 	if err != nil {
-		return fmt.Errorf("failed to load data: %w", err)
+		return err
+	}
+
+	outputDir := p.determineOutputDir(templatePath, multiple)
+	if p.config.ForeachDoc {
+		return p.processDocuments(tmpl, documents, templatePath, outputDir)
 	}
 
 	// Process the template
-	return p.executeTemplate(tmpl, data, templatePath, multiple)
+	return p.executeTemplate(tmpl, withEnv(documents[0]), templatePath, outputDir)
+}
+
+// templateDocuments returns the data documents a template is rendered with: every document
+// of its data file in foreach-doc mode and only the first one otherwise. Each document is
+// merged over the data inherited from ancestor directories, then the environment overlay
+// of the template directory and the value overrides are merged over it. The result is
+// validated against the template's schema, which fills in its defaults.
+func (p *TemplateProcessor) templateDocuments(templatePath string, multiple bool) ([]interface{}, error) {
+	inherited, err := p.inheritedData(templatePath, multiple)
+	if err != nil {
+		return nil, err
+	}
+
+	dataPath, fileDocuments, documents, err := p.templateData(templatePath)
+	if err != nil {
+		return nil, err
+	}
+
+	overlay, err := p.loadOverlay(filepath.Dir(templatePath))
+	if err != nil {
+		return nil, err
+	}
+
+	for i, document := range documents {
+		if document, err = mergeInherited(inherited, document); err != nil {
+			return nil, fmt.Errorf("failed to merge %s over inherited data: %w", dataPath, err)
+		}
+		if overlay != nil {
+			if document, err = mergeLayers(document, overlay); err != nil {
+				return nil, fmt.Errorf("failed to merge the %s overlay into %s: %w", p.environment, dataPath, err)
+			}
+		}
+		if document, err = p.applyOverrides(document); err != nil {
+			return nil, fmt.Errorf("failed to merge values into %s: %w", dataPath, err)
+		}
+		documents[i] = document
+	}
+
+	// The final data is checked against the schema next to the data file, if any
+	if err := p.validateDocuments(documents, fileDocuments, templatePath, dataPath); err != nil {
+		return nil, err
+	}
+	return documents, nil
+}
+
+// templateData loads the data documents of a template directory: its data file, with the
+// fragments of its data directory merged over each document. The data directory may also be
+// used without a data file. The returned path names the data file, or the data directory
+// when there is no data file. The documents of the data file itself are returned too, as
+// they were before anything was merged into them.
+func (p *TemplateProcessor) templateData(templatePath string) (string, []interface{}, []interface{}, error) {
+	templateDir := filepath.Dir(templatePath)
+	fragmentPaths, err := FindDataFragments(templateDir)
+	if err != nil {
+		return "", nil, nil, err
+	}
+
+	// Get data file path based on template path
+	dataPath, err := p.getDataFilePath(templatePath)
+	var documents, fileDocuments []interface{}
+	switch {
+	case err == nil:
+		logf("Using data file: %s\n", dataPath)
+		if p.config.ForeachDoc {
+			documents, err = p.loadDocuments(dataPath)
+		} else {
+			var data interface{}
+			data, err = p.loadData(dataPath)
+			documents = []interface{}{data}
+		}
+		if err != nil {
+			return "", nil, nil, fmt.Errorf("failed to load data: %w", err)
+		}
+		for _, document := range documents {
+			fileDocuments = append(fileDocuments, copyValue(document))
+		}
+	case errors.Is(err, os.ErrNotExist) && len(fragmentPaths) > 0:
+		dataPath = filepath.Join(templateDir, dataDirName())
+		documents = []interface{}{nil}
+	default:
+		return "", nil, nil, err
+	}
+
+	if len(fragmentPaths) == 0 {
+		return dataPath, fileDocuments, documents, nil
+	}
+
+	fragments := make([]*dataFragment, len(fragmentPaths))
+	for i, path := range fragmentPaths {
+		logf("Using data fragment: %s\n", path)
+		if fragments[i], err = p.loadFragment(path); err != nil {
+			return "", nil, nil, err
+		}
+	}
+	for i, document := range documents {
+		if documents[i], err = mergeFragments(dataPath, document, fragments); err != nil {
+			return "", nil, nil, fmt.Errorf("failed to merge data fragments: %w", err)
+		}
+	}
+	return dataPath, fileDocuments, documents, nil
+}
+
+// processDocuments renders a template once per data document, each into its own output
+// subdirectory
+func (p *TemplateProcessor) processDocuments(tmpl Template, documents []interface{}, templatePath, outputDir string) error {
+	used := make(map[string]int, len(documents))
+	for i, document := range documents {
+		name, err := p.documentDirName(i, document)
+		if err != nil {
+			return err
+		}
+		if previous, exists := used[name]; exists {
+			return fmt.Errorf("documents %d and %d both render into %q", previous, i, name)
+		}
+		used[name] = i
+
+		if err := p.executeTemplate(tmpl, withEnv(document), templatePath, filepath.Join(outputDir, name)); err != nil {
+			return fmt.Errorf("document %d: %w", i, err)
+		}
+	}
+	return nil
+}
+
+// documentDirName returns the output subdirectory of a document: the value of the
+// foreach-key field when it is set, and doc-NN after the document index otherwise
+func (p *TemplateProcessor) documentDirName(index int, document interface{}) (string, error) {
+	if p.config.ForeachKey == "" {
+		return fmt.Sprintf("doc-%02d", index), nil
+	}
+
+	root, ok := document.(map[string]interface{})
+	if !ok {
+		return "", fmt.Errorf("document %d is not a mapping, so it has no %q key", index, p.config.ForeachKey)
+	}
+	name := toString(root[p.config.ForeachKey])
+	if name == "" {
+		return "", fmt.Errorf("document %d has no value for key %q", index, p.config.ForeachKey)
+	}
+	if name == "." || name == ".." || strings.ContainsAny(name, `/\`) {
+		return "", fmt.Errorf("document %d: %q of key %q is not a valid directory name", index, name, p.config.ForeachKey)
+	}
+	return name, nil
 }
 
 // resetConfig resets the configuration to default values
 func (p *TemplateProcessor) resetConfig() {
 	p.config.Extension = strings.TrimPrefix(config.OutputExtension, ".")
 	p.config.Separate = p.defaultSeparate
+	p.config.Engine = config.Engine
+	p.config.MissingKey = config.MissingKey
+	p.config.LeftDelim = config.LeftDelim
+	p.config.RightDelim = config.RightDelim
+	p.config.ForeachDoc = p.defaultPerDocument
+	p.config.ForeachKey = ""
 	p.configSet = false
 }
 
 // getDataFilePath returns the path to the data file for a template
-func (p *TemplateProcessor) getDataFilePath(templatePath string) string {
-	dir := filepath.Dir(templatePath)
-	return filepath.Join(dir, config.DataFile)
+func (p *TemplateProcessor) getDataFilePath(templatePath string) (string, error) {
+	return FindDataFile(filepath.Dir(templatePath))
 }
 
 // loadTemplate loads and parses a template file
-func (p *TemplateProcessor) loadTemplate(templatePath string) (*template.Template, error) {
-	return template.ParseFiles(templatePath)
+func (p *TemplateProcessor) loadTemplate(templatePath string) (Template, error) {
+	content, err := os.ReadFile(templatePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read template file: %w", err)
+	}
+	text := string(content)
+
+	// Options that affect parsing have to be read from the raw template text.
+	// They are removed from the directive, since delims=... can't be parsed with the new delimiters.
+	line := firstLine(text)
+	directive, err := p.parseTemplateDirective(line)
+	if err != nil {
+		return nil, fmt.Errorf("invalid config directive in %s: %w", templatePath, err)
+	}
+	text = directive + text[len(line):]
+
+	set := newTemplateSet()
+	funcs, err := p.funcMap(templatePath, set)
+	if err != nil {
+		return nil, err
+	}
+	parsed := p.newTemplate(filepath.Base(templatePath), funcs)
+
+	// Shared definitions are added first so the template can use and override them
+	partials, err := p.findPartials(templatePath)
+	if err != nil {
+		return nil, err
+	}
+	if err := p.addPartials(set, parsed, partials, funcs); err != nil {
+		return nil, err
+	}
+
+	if _, err := parsed.Parse(text); err != nil {
+		return nil, err
+	}
+	if preserveOrder() {
+		orderRanges(parsed)
+	}
+
+	tmpl, err := newEngineTemplate(p.config.Engine, parsed, funcs, p.templateOptions()...)
+	if err != nil {
+		return nil, err
+	}
+
+	set.parsed = parsed
+	set.tmpl = tmpl
+	set.files[parsed.Name()] = templatePath
+	return set, nil
 }
 
-// loadData loads data from a YAML file
-func (p *TemplateProcessor) loadData(dataPath string) (interface{}, error) {
-	file, err := os.Open(dataPath)
+// newTemplate creates an empty template configured with the given functions, delimiters and options
+func (p *TemplateProcessor) newTemplate(name string, funcs template.FuncMap) *template.Template {
+	return template.New(name).
+		Delims(p.config.LeftDelim, p.config.RightDelim).
+		Funcs(funcs).
+		Option(p.templateOptions()...)
+}
+
+// templateOptions returns the text/template options for the current configuration
+func (p *TemplateProcessor) templateOptions() []string {
+	return []string{"missingkey=" + p.config.MissingKey}
+}
+
+// funcMap returns the functions available to a template of the given set
+func (p *TemplateProcessor) funcMap(templatePath string, set *templateSet) (template.FuncMap, error) {
+	sandbox, err := newFileSandbox(p.rootDir(templatePath), filepath.Dir(templatePath))
 	if err != nil {
-		return nil, fmt.Errorf("failed to open data file: %w", err)
+		return nil, err
 	}
-	defer file.Close()
 
-	var data interface{}
-	if err := yaml.NewDecoder(file).Decode(&data); err != nil {
-		return nil, fmt.Errorf("failed to decode YAML data: %w", err)
+	funcs := builtinFuncs()
+	for _, extra := range []template.FuncMap{set.funcs(), sandbox.funcs(), envFuncs(), timeFuncs(p.now), orderFuncs()} {
+		for name, fn := range extra {
+			funcs[name] = fn
+		}
+	}
+
+	// Plugins are started by the first template and kept running until Close
+	if p.plugins == nil {
+		plugins, err := startPlugins(config.Plugins, funcs)
+		if err != nil {
+			return nil, err
+		}
+		p.plugins = plugins
+	}
+	for name, fn := range p.plugins.funcs {
+		funcs[name] = fn
 	}
 
-	return data, nil
+	if err := p.addUserFuncs(set, funcs); err != nil {
+		return nil, err
+	}
+	return funcs, nil
 }
 
-// executeTemplate executes a template with provided data
-func (p *TemplateProcessor) executeTemplate(tmpl *template.Template, data interface{}, templatePath string, multiple bool) error {
-	// Determine output directory
-	outputDir := p.determineOutputDir(templatePath, multiple)
+// firstLine returns the first line of text without its line ending
+func firstLine(text string) string {
+	if idx := strings.IndexByte(text, '\n'); idx >= 0 {
+		text = text[:idx]
+	}
+	return strings.TrimRight(text, "\r")
+}
 
+// loadData loads the first document of a data file, decoded according to its extension
+func (p *TemplateProcessor) loadData(dataPath string) (interface{}, error) {
+	documents, err := p.loadDocuments(dataPath)
+	if err != nil {
+		return nil, err
+	}
+	if len(documents) > 1 {
+		logf("Warning: %s has %d documents, only the first one is used (set foreach-doc=true to render each one)\n",
+			dataPath, len(documents))
+	}
+	return documents[0], nil
+}
+
+// loadDocuments loads every document of a data file, decoded according to its extension.
+// Data templates are rendered first.
+func (p *TemplateProcessor) loadDocuments(dataPath string) ([]interface{}, error) {
+	content, err := os.ReadFile(dataPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open data file: %w", err)
+	}
+	if isDataTemplate(dataPath) {
+		return p.decodeDataTemplate(dataPath, content)
+	}
+	return decodeDocuments(dataPath, content, p.rootDir(dataPath), p.secrets)
+}
+
+// executeTemplate executes a template with provided data and writes the output to outputDir
+func (p *TemplateProcessor) executeTemplate(tmpl Template, data interface{}, templatePath, outputDir string) error {
 	// Create output directory
 	if err := os.MkdirAll(outputDir, 0755); err != nil {
 		return fmt.Errorf("failed to create output directory: %w", err)
 	}
 
-	// Debug output
-	fmt.Printf("Template path: %s\n", templatePath)
-	fmt.Printf("Template data: %+v\n", data)
+	// Debug output, without the values decrypted from the data
+	logf("Template path: %s\n", templatePath)
+	logf("Template data: %+v\n", p.secrets.mask(data))
 
-	// Execute template to buffer
+	// Execute template to buffer. Errors may quote the values functions failed on.
 	var buf bytes.Buffer
 	if err := tmpl.Execute(&buf, data); err != nil {
-		return fmt.Errorf("failed to execute template: %w", err)
+		return p.secrets.redactError(fmt.Errorf("failed to execute template: %w", err))
 	}
 
 	// Debug output
-	fmt.Printf("Template output:\n%s\n", buf.String())
+	logf("Template output:\n%s\n", p.secrets.redact(buf.String()))
 
 	// Parse the template output
 	return p.processTemplateOutput(&buf, outputDir)
@@ -138,7 +453,7 @@ func (p *TemplateProcessor) determineOutputDir(templatePath string, multiple boo
 		outputDir = config.OutputDir
 	}
 
-	fmt.Printf("Output directory: %s\n", outputDir)
+	logf("Output directory: %s\n", outputDir)
 	return outputDir
 }
 
@@ -167,8 +482,7 @@ func (p *TemplateProcessor) processTemplateOutput(output *bytes.Buffer, outputDi
 
 	// Process config line if present
 	startIdx := 0
-	if len(lines) > 0 && strings.HasPrefix(lines[0], "# config") {
-		p.parseConfigLine(lines[0])
+	if len(lines) > 0 && p.parseConfigLine(lines[0]) {
 		startIdx = 1
 	}
 
@@ -184,27 +498,62 @@ func (p *TemplateProcessor) processTemplateOutput(output *bytes.Buffer, outputDi
 	return p.processSingleOutput(bytes.NewBufferString(content), outputDir)
 }
 
-// parseConfigLine parses a configuration line at the top of a template output
+// configPrefix starts the config directive on the first line of a template
+const configPrefix = "# config"
+
+// directiveOption is a key=value option of the config directive, with its position in the line
+type directiveOption struct {
+	key, value string
+	start, end int
+}
+
+// parseDirective splits a config directive line into its whitespace separated options. It is
+// used both on the raw template text and on the rendered output, so the two always agree.
+// Words without "=" are returned with an empty value. ok is false when the line isn't a
+// config directive.
+func parseDirective(line string) (options []directiveOption, ok bool) {
+	rest, found := strings.CutPrefix(line, configPrefix)
+	if !found || (rest != "" && !isDirectiveSpace(rest[0])) {
+		return nil, false
+	}
+
+	offset := len(configPrefix)
+	for i := offset; i < len(line); {
+		if isDirectiveSpace(line[i]) {
+			i++
+			continue
+		}
+		end := i
+		for end < len(line) && !isDirectiveSpace(line[end]) {
+			end++
+		}
+		key, value, _ := strings.Cut(line[i:end], "=")
+		options = append(options, directiveOption{key: key, value: value, start: i, end: end})
+		i = end
+	}
+	return options, true
+}
+
+// isDirectiveSpace reports whether c separates config directive options
+func isDirectiveSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\r'
+}
+
+// parseConfigLine applies the config directive options that affect the rendered output
 func (p *TemplateProcessor) parseConfigLine(line string) bool {
-	// Check if this is a config line
-	if !strings.HasPrefix(line, "# config") {
+	options, ok := parseDirective(line)
+	if !ok {
 		return false
 	}
 
-	// Parse config directives
-	parts := strings.Fields(line)
-	for i := 2; i < len(parts); i++ {
-		part := parts[i]
-		if strings.HasPrefix(part, "ext=") {
-			p.config.Extension = strings.TrimPrefix(part, "ext=")
+	for _, option := range options {
+		switch option.key {
+		case "ext":
+			p.config.Extension = option.value
 			p.configSet = true
-		} else if strings.HasPrefix(part, "separate=") {
-			separateValue := strings.TrimPrefix(part, "separate=")
-			if separateValue == "true" {
-				p.config.Separate = true
-				p.configSet = true
-			} else if separateValue == "false" {
-				p.config.Separate = false
+		case "separate":
+			if option.value == "true" || option.value == "false" {
+				p.config.Separate = option.value == "true"
 				p.configSet = true
 			}
 		}
@@ -213,6 +562,63 @@ func (p *TemplateProcessor) parseConfigLine(line string) bool {
 	return true
 }
 
+// parseTemplateDirective applies the config directive options that must be known before
+// the template is parsed. The line is taken from the raw template text, so options that
+// only affect the rendered output are left to parseConfigLine. It returns the line without
+// the options it consumed, leaving the rest of it untouched.
+func (p *TemplateProcessor) parseTemplateDirective(line string) (string, error) {
+	options, ok := parseDirective(line)
+	if !ok {
+		return line, nil
+	}
+
+	var remaining strings.Builder
+	last := 0
+	for _, option := range options {
+		switch option.key {
+		case "engine":
+			if !validEngine(option.value) {
+				return "", fmt.Errorf("unsupported engine %q (expected %q or %q)",
+					option.value, config.EngineText, config.EngineHTML)
+			}
+			p.config.Engine = option.value
+		case "missingkey":
+			if !config.ValidMissingKey(option.value) {
+				return "", fmt.Errorf("unsupported missingkey %q (expected %q, %q or %q)", option.value,
+					config.MissingKeyDefault, config.MissingKeyZero, config.MissingKeyError)
+			}
+			p.config.MissingKey = option.value
+		case "delims":
+			left, right, ok := strings.Cut(option.value, ",")
+			if !ok || left == "" || right == "" {
+				return "", fmt.Errorf("invalid delims %q (expected delims=LEFT,RIGHT)", line[option.start:option.end])
+			}
+			p.config.LeftDelim = left
+			p.config.RightDelim = right
+		case "foreach-doc":
+			if option.value != "true" && option.value != "false" {
+				return "", fmt.Errorf("invalid foreach-doc %q (expected true or false)", option.value)
+			}
+			p.config.ForeachDoc = option.value == "true"
+		case "foreach-key":
+			if option.value == "" {
+				return "", fmt.Errorf("foreach-key needs a key name")
+			}
+			p.config.ForeachKey = option.value
+			// Naming the output after a key only makes sense per document
+			p.config.ForeachDoc = true
+		default:
+			continue
+		}
+		p.configSet = true
+		remaining.WriteString(line[last:option.start])
+		last = option.end
+	}
+	remaining.WriteString(line[last:])
+
+	return remaining.String(), nil
+}
+
 // processSeparatedOutput processes output as multiple files split by YAML separators
 func (p *TemplateProcessor) processSeparatedOutput(output *bytes.Buffer, outputDir string) error {
 	scanner := bufio.NewScanner(output)
@@ -266,7 +672,7 @@ func (p *TemplateProcessor) processSingleOutput(output *bytes.Buffer, outputDir
 
 	// Write content to file
 	content := output.String()
-	fmt.Printf("Writing content to %s:\n%s\n", outputPath, content)
+	logf("Writing content to %s:\n%s\n", outputPath, p.secrets.redact(content))
 	return p.writeFile(outputPath, content)
 }
 
@@ -316,7 +722,7 @@ func (p *TemplateProcessor) writeFile(path string, content string) error {
 		return fmt.Errorf("failed to sync file: %w", err)
 	}
 
-	fmt.Printf("Successfully wrote file: %s\n", path)
+	logf("Successfully wrote file: %s\n", path)
 	return nil
 }
 
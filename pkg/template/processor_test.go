@@ -0,0 +1,1084 @@
+package template
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/Samet-MohamedAmin/gotmpl/pkg/config"
+)
+
+// renderTemplate writes a template and its data file into a temporary directory,
+// processes it as a single output file and returns the generated content
+func renderTemplate(t *testing.T, templateContent, dataContent string) string {
+	t.Helper()
+
+	output, err := tryRenderTemplate(t, templateContent, dataContent)
+	if err != nil {
+		t.Fatalf("ProcessTemplate failed: %v", err)
+	}
+	return output
+}
+
+// tryRenderTemplate is like renderTemplate but returns the processing error
+func tryRenderTemplate(t *testing.T, templateContent, dataContent string) (string, error) {
+	t.Helper()
+
+	srcDir := t.TempDir()
+	config.Reset()
+	config.OutputDir = t.TempDir()
+
+	templatePath := filepath.Join(srcDir, config.TemplateFile)
+	if err := os.WriteFile(templatePath, []byte(templateContent), 0644); err != nil {
+		t.Fatalf("Failed to write template: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(srcDir, config.DataFile), []byte(dataContent), 0644); err != nil {
+		t.Fatalf("Failed to write data: %v", err)
+	}
+
+	processor := NewProcessor(false)
+	defer processor.Close()
+	if err := processor.ProcessTemplate(templatePath, false); err != nil {
+		return "", err
+	}
+
+	content, err := os.ReadFile(filepath.Join(config.OutputDir, config.DefaultPrefix))
+	if err != nil {
+		t.Fatalf("Failed to read output: %v", err)
+	}
+	return string(content), nil
+}
+
+func TestProcessTemplateEngine(t *testing.T) {
+	data := `Name: "Tom & 'Jerry' <cat>"`
+
+	testCases := []struct {
+		name     string
+		template string
+		expected string
+	}{
+		{
+			name:     "Text engine does not escape",
+			template: "Hello, {{ .Name }}!",
+			expected: "Hello, Tom & 'Jerry' <cat>!",
+		},
+		{
+			name:     "HTML engine from config directive",
+			template: "# config engine=html\n<p>{{ .Name }}</p>",
+			expected: "<p>Tom &amp; &#39;Jerry&#39; &lt;cat&gt;</p>",
+		},
+		{
+			name:     "HTML engine include piped into string functions",
+			template: "# config engine=html\n{{ define \"name\" }}<b>{{ .Name }}</b>{{ end }}<p>{{ include \"name\" . | indent 2 }}</p>",
+			expected: "<p>  &lt;b&gt;Tom &amp;amp; &amp;#39;Jerry&amp;#39; &amp;lt;cat&amp;gt;&lt;/b&gt;</p>",
+		},
+		{
+			name:     "HTML engine include marked as trusted",
+			template: "# config engine=html\n{{ define \"name\" }}<b>{{ .Name }}</b>{{ end }}<p>{{ include \"name\" . | indent 2 | safeHTML }}</p>",
+			expected: "<p>  <b>Tom &amp; &#39;Jerry&#39; &lt;cat&gt;</b></p>",
+		},
+		{
+			name:     "HTML engine tpl marked as trusted",
+			template: "# config engine=html\n<p>{{ tpl \"<i>{{ .Name | html }}</i>\" . | safeHTML }}</p>",
+			expected: "<p><i>Tom &amp; &#39;Jerry&#39; &lt;cat&gt;</i></p>",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			output := renderTemplate(t, tc.template, data)
+			if strings.TrimSpace(output) != tc.expected {
+				t.Errorf("Expected output %q, got %q", tc.expected, output)
+			}
+		})
+	}
+}
+
+func TestProcessTemplateInvalidEngine(t *testing.T) {
+	_, err := tryRenderTemplate(t, "# config engine=xml\nHello", "Name: test")
+	if err == nil || !strings.Contains(err.Error(), "unsupported engine") {
+		t.Errorf("Expected unsupported engine error, got %v", err)
+	}
+}
+
+// writeFiles creates files relative to dir, creating parent directories as needed
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("Failed to create directory for %s: %v", name, err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+}
+
+func TestProcessTemplatePartials(t *testing.T) {
+	rootDir := t.TempDir()
+	partialsDir := t.TempDir()
+	config.Reset()
+	config.OutputDir = t.TempDir()
+	config.PartialsDir = partialsDir
+	defer config.Reset()
+
+	writeFiles(t, partialsDir, map[string]string{
+		"common.tmpl": `{{ define "header" }}# {{ .Name }}{{ end }}`,
+	})
+	writeFiles(t, rootDir, map[string]string{
+		"_labels.tmpl":           `{{ define "labels" }}app: {{ .Name }}{{ end }}`,
+		"app/_local.tmpl":        `{{ define "local" }}local{{ end }}`,
+		"app/template.go.tmpl":   "{{ template \"header\" . }}\n{{ template \"labels\" . }}\n{{ template \"local\" . }}",
+		"app/data.yaml":          "Name: web",
+		"other/_labels.tmpl":     `{{ define "labels" }}unused{{ end }}`,
+		"other/template.go.tmpl": "unused",
+	})
+
+	processor := NewProcessor(false)
+	processor.SetSourceRoot(rootDir)
+	defer processor.Close()
+	if err := processor.ProcessTemplate(filepath.Join(rootDir, "app", config.TemplateFile), false); err != nil {
+		t.Fatalf("ProcessTemplate failed: %v", err)
+	}
+
+	content, err := os.ReadFile(filepath.Join(config.OutputDir, config.DefaultPrefix))
+	if err != nil {
+		t.Fatalf("Failed to read output: %v", err)
+	}
+	expected := "# web\napp: web\nlocal"
+	if strings.TrimSpace(string(content)) != expected {
+		t.Errorf("Expected output %q, got %q", expected, string(content))
+	}
+}
+
+func TestProcessTemplatePartialsWithDelims(t *testing.T) {
+	rootDir := t.TempDir()
+	config.Reset()
+	config.OutputDir = t.TempDir()
+	defer config.Reset()
+
+	writeFiles(t, rootDir, map[string]string{
+		"_labels.tmpl":         `{{ define "labels" }}app: {{ .Name }}{{ end }}`,
+		"app/template.go.tmpl": "# config delims=[[,]]\n[[ template \"labels\" . ]]\nref: ${{ github.sha }}",
+		"app/data.yaml":        "Name: web",
+	})
+
+	processor := NewProcessor(false)
+	processor.SetSourceRoot(rootDir)
+	defer processor.Close()
+	if err := processor.ProcessTemplate(filepath.Join(rootDir, "app", config.TemplateFile), false); err != nil {
+		t.Fatalf("ProcessTemplate failed: %v", err)
+	}
+
+	content, err := os.ReadFile(filepath.Join(config.OutputDir, config.DefaultPrefix))
+	if err != nil {
+		t.Fatalf("Failed to read output: %v", err)
+	}
+	expected := "app: web\nref: ${{ github.sha }}"
+	if strings.TrimSpace(string(content)) != expected {
+		t.Errorf("Expected output %q, got %q", expected, string(content))
+	}
+}
+
+func TestProcessTemplatePartialsDir(t *testing.T) {
+	rootDir := t.TempDir()
+	config.Reset()
+	config.OutputDir = t.TempDir()
+	config.PartialsDir = "shared"
+	defer config.Reset()
+
+	writeFiles(t, rootDir, map[string]string{
+		"shared/common.tmpl":   `{{ define "header" }}# {{ .Name }}{{ end }}`,
+		"app/template.go.tmpl": `{{ template "header" . }}`,
+		"app/data.yaml":        "Name: web",
+	})
+
+	output, err := renderTemplateDir(t, rootDir, "app")
+	if err != nil {
+		t.Fatalf("ProcessTemplate failed: %v", err)
+	}
+	if strings.TrimSpace(output) != "# web" {
+		t.Errorf("Expected output %q, got %q", "# web", output)
+	}
+
+	writeFiles(t, rootDir, map[string]string{"shared/" + config.TemplateFile: "stray"})
+	_, err = renderTemplateDir(t, rootDir, "app")
+	if err == nil || !strings.Contains(err.Error(), "contains a template file") {
+		t.Errorf("Expected a template file conflict, got %v", err)
+	}
+}
+
+func TestProcessTemplatePartialClash(t *testing.T) {
+	rootDir := t.TempDir()
+	config.Reset()
+	config.OutputDir = t.TempDir()
+
+	writeFiles(t, rootDir, map[string]string{
+		"_labels.tmpl":         `{{ define "labels" }}root{{ end }}`,
+		"app/_labels.tmpl":     `{{ define "labels" }}app{{ end }}`,
+		"app/template.go.tmpl": `{{ template "labels" . }}`,
+		"app/data.yaml":        "Name: web",
+	})
+
+	processor := NewProcessor(false)
+	processor.SetSourceRoot(rootDir)
+	defer processor.Close()
+	err := processor.ProcessTemplate(filepath.Join(rootDir, "app", config.TemplateFile), false)
+	if err == nil {
+		t.Fatal("Expected a name clash error")
+	}
+	for _, path := range []string{filepath.Join(rootDir, "_labels.tmpl"), filepath.Join(rootDir, "app", "_labels.tmpl")} {
+		if !strings.Contains(err.Error(), path) {
+			t.Errorf("Expected error to mention %s, got %v", path, err)
+		}
+	}
+}
+
+func TestProcessTemplateIncludeAndTpl(t *testing.T) {
+	data := "Name: web\nGreeting: \"Hello, {{ .Name | upper }}!\"\n"
+
+	testCases := []struct {
+		name     string
+		template string
+		expected string
+	}{
+		{
+			name:     "Include can be piped",
+			template: "{{ define \"labels\" }}app: {{ .Name }}\ntier: web{{ end }}labels:\n{{ include \"labels\" . | indent 2 }}",
+			expected: "labels:\n  app: web\n  tier: web",
+		},
+		{
+			name:     "Tpl renders data as a template",
+			template: "{{ tpl .Greeting . }}",
+			expected: "Hello, WEB!",
+		},
+		{
+			name:     "Tpl can use definitions from the set",
+			template: "{{ define \"name\" }}{{ .Name }}{{ end }}{{ tpl \"{{ include \\\"name\\\" . }}\" . }}",
+			expected: "web",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			output := renderTemplate(t, tc.template, data)
+			if strings.TrimSpace(output) != tc.expected {
+				t.Errorf("Expected output %q, got %q", tc.expected, output)
+			}
+		})
+	}
+}
+
+func TestProcessTemplateIncludeRecursion(t *testing.T) {
+	_, err := tryRenderTemplate(t, `{{ define "loop" }}{{ include "loop" . }}{{ end }}{{ include "loop" . }}`, "Name: web")
+	if err == nil || !strings.Contains(err.Error(), "maximum nesting depth") {
+		t.Errorf("Expected nesting depth error, got %v", err)
+	}
+}
+
+func TestProcessTemplateMissingKey(t *testing.T) {
+	data := "Name: web\nImage:\n  Repo: nginx\n"
+
+	t.Run("Default renders no value", func(t *testing.T) {
+		output := renderTemplate(t, "tag: {{ .Image.Tag }}", data)
+		if strings.TrimSpace(output) != "tag: <no value>" {
+			t.Errorf("Unexpected output %q", output)
+		}
+	})
+
+	t.Run("Config directive enables errors", func(t *testing.T) {
+		_, err := tryRenderTemplate(t, "# config missingkey=error\nname: {{ .Name }}\ntag: {{ .Image.Tag }}", data)
+
+		var missingKeyErr *MissingKeyError
+		if !errors.As(err, &missingKeyErr) {
+			t.Fatalf("Expected MissingKeyError, got %v", err)
+		}
+		if !strings.HasSuffix(missingKeyErr.File, string(filepath.Separator)+config.TemplateFile) {
+			t.Errorf("Expected error to name the template path, got %s", missingKeyErr.File)
+		}
+		if missingKeyErr.Line != 3 {
+			t.Errorf("Expected line 3, got %d", missingKeyErr.Line)
+		}
+		if missingKeyErr.Field != ".Image.Tag" {
+			t.Errorf("Expected field .Image.Tag, got %s", missingKeyErr.Field)
+		}
+	})
+
+	t.Run("Invalid directive value", func(t *testing.T) {
+		_, err := tryRenderTemplate(t, "# config missingkey=panic\n{{ .Name }}", data)
+		if err == nil || !strings.Contains(err.Error(), "unsupported missingkey") {
+			t.Errorf("Expected unsupported missingkey error, got %v", err)
+		}
+	})
+}
+
+func TestProcessTemplateDelims(t *testing.T) {
+	data := "Name: web"
+
+	t.Run("Config directive", func(t *testing.T) {
+		output := renderTemplate(t, "# config delims=[[,]]\nname: [[ .Name | upper ]]\nref: ${{ github.sha }}", data)
+		expected := "name: WEB\nref: ${{ github.sha }}"
+		if strings.TrimSpace(output) != expected {
+			t.Errorf("Expected output %q, got %q", expected, output)
+		}
+	})
+
+	t.Run("Other options and odd spacing", func(t *testing.T) {
+		output := renderTemplate(t, "# config  separate=false\tdelims=[[,]]   engine=text  \n[[ .Name ]]\n---\n{{ .Name }}", data)
+		expected := "web\n---\n{{ .Name }}"
+		if strings.TrimSpace(output) != expected {
+			t.Errorf("Expected output %q, got %q", expected, output)
+		}
+
+		_, err := tryRenderTemplate(t, "# config\tmissingkey=error  delims=[[,]] separate=false\n[[ .Missing ]]", data)
+		if err == nil || !strings.Contains(err.Error(), "Missing") {
+			t.Errorf("Expected missing key error, got %v", err)
+		}
+	})
+
+	t.Run("Invalid directive value", func(t *testing.T) {
+		_, err := tryRenderTemplate(t, "# config delims=[[\n[[ .Name ]]", data)
+		if err == nil || !strings.Contains(err.Error(), "invalid delims") {
+			t.Errorf("Expected invalid delims error, got %v", err)
+		}
+	})
+}
+
+// renderTemplateDir processes the template in rootDir/name with rootDir as the source root
+// and returns the generated single output file
+func renderTemplateDir(t *testing.T, rootDir, name string) (string, error) {
+	t.Helper()
+
+	processor := NewProcessor(false)
+	processor.SetSourceRoot(rootDir)
+	defer processor.Close()
+	if err := processor.ProcessTemplate(filepath.Join(rootDir, name, config.TemplateFile), false); err != nil {
+		return "", err
+	}
+
+	content, err := os.ReadFile(filepath.Join(config.OutputDir, config.DefaultPrefix))
+	if err != nil {
+		t.Fatalf("Failed to read output: %v", err)
+	}
+	return string(content), nil
+}
+
+func TestProcessTemplateFileFuncs(t *testing.T) {
+	testCases := []struct {
+		name     string
+		template string
+		expected string
+		errorMsg string
+	}{
+		{
+			name:     "Read file relative to the template",
+			template: "cert: |\n{{ readFile \"files/ca.pem\" | indent 2 }}",
+			expected: "cert: |\n  line 1\n  line 2",
+		},
+		{
+			name:     "Read file from the source root",
+			template: `{{ readFile "../shared.sql" }}`,
+			expected: "SELECT 1;",
+		},
+		{
+			name:     "Base64 encode file content",
+			template: `{{ readFile "../shared.sql" | base64enc }}`,
+			expected: "U0VMRUNUIDE7",
+		},
+		{
+			name:     "File exists",
+			template: `{{ fileExists "files/ca.pem" }} {{ fileExists "files/missing" }}`,
+			expected: "true false",
+		},
+		{
+			name:     "Glob",
+			template: `{{ glob "files/*.pem" }}`,
+			expected: "[files/ca.pem files/client.pem]",
+		},
+		{
+			name:     "Glob results can be read",
+			template: `{{ range glob "files/*.pem" }}{{ base . }}={{ readFile . }};{{ end }}`,
+			expected: "ca.pem=line 1\nline 2;client.pem=client;",
+		},
+		{
+			name:     "Read directory",
+			template: `{{ readDir "files" }}`,
+			expected: "[ca.pem client.pem]",
+		},
+		{
+			name:     "Refuse paths outside the source root",
+			template: `{{ readFile "../../secret" }}`,
+			errorMsg: "outside the source root",
+		},
+		{
+			name:     "Refuse glob patterns outside the source root",
+			template: `{{ glob "../../*" }}`,
+			errorMsg: "outside the source root",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			rootDir := t.TempDir()
+			config.Reset()
+			config.OutputDir = t.TempDir()
+
+			writeFiles(t, rootDir, map[string]string{
+				"shared.sql":           "SELECT 1;",
+				"app/files/ca.pem":     "line 1\nline 2",
+				"app/files/client.pem": "client",
+				"app/data.yaml":        "Name: web",
+				"app/template.go.tmpl": tc.template,
+			})
+
+			output, err := renderTemplateDir(t, rootDir, "app")
+			if tc.errorMsg != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.errorMsg) {
+					t.Errorf("Expected error containing %q, got %v", tc.errorMsg, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ProcessTemplate failed: %v", err)
+			}
+			if strings.TrimSpace(output) != tc.expected {
+				t.Errorf("Expected output %q, got %q", tc.expected, output)
+			}
+		})
+	}
+}
+
+func TestProcessTemplateEnv(t *testing.T) {
+	t.Setenv("GOTMPL_TEST_SHA", "abc123")
+	t.Setenv("GOTMPL_TEST_REGISTRY", "registry.local")
+	t.Setenv("GOTMPL_SECRET", "hunter2")
+
+	testCases := []struct {
+		name      string
+		allowlist []string
+		template  string
+		expected  string
+		errorMsg  string
+	}{
+		{
+			name:      "Env function",
+			allowlist: []string{"GOTMPL_TEST_*"},
+			template:  `{{ env "GOTMPL_TEST_REGISTRY" }}/app:{{ env "GOTMPL_TEST_SHA" }}`,
+			expected:  "registry.local/app:abc123",
+		},
+		{
+			name:      "Env map on the data root",
+			allowlist: []string{"GOTMPL_TEST_SHA"},
+			template:  `{{ .Name }}:{{ .Env.GOTMPL_TEST_SHA }} {{ len .Env }}`,
+			expected:  "web:abc123 1",
+		},
+		{
+			name:      "Unset variable is empty",
+			allowlist: []string{"GOTMPL_TEST_*"},
+			template:  `[{{ env "GOTMPL_TEST_UNSET" }}]`,
+			expected:  "[]",
+		},
+		{
+			name:      "Variable outside the allowlist",
+			allowlist: []string{"GOTMPL_TEST_*"},
+			template:  `{{ env "GOTMPL_SECRET" }}`,
+			errorMsg:  "not allowed by EnvAllowlist",
+		},
+		{
+			name:     "No allowlist",
+			template: `{{ env "GOTMPL_TEST_SHA" }}`,
+			errorMsg: "not allowed by EnvAllowlist",
+		},
+		{
+			name:      "Required variable is unset",
+			allowlist: []string{"GOTMPL_TEST_*"},
+			template:  `{{ requiredEnv "GOTMPL_TEST_UNSET" }}`,
+			errorMsg:  "is not set",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			srcDir := t.TempDir()
+			config.Reset()
+			config.OutputDir = t.TempDir()
+			config.EnvAllowlist = tc.allowlist
+			defer config.Reset()
+
+			writeFiles(t, srcDir, map[string]string{
+				"app/data.yaml":        "Name: web",
+				"app/template.go.tmpl": tc.template,
+			})
+
+			output, err := renderTemplateDir(t, srcDir, "app")
+			if tc.errorMsg != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.errorMsg) {
+					t.Errorf("Expected error containing %q, got %v", tc.errorMsg, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ProcessTemplate failed: %v", err)
+			}
+			if strings.TrimSpace(output) != tc.expected {
+				t.Errorf("Expected output %q, got %q", tc.expected, output)
+			}
+		})
+	}
+}
+
+func TestProcessTemplateUserFuncs(t *testing.T) {
+	functions := map[string]string{
+		"fqdn":     "{{ .name }}.{{ .ns }}.svc.cluster.local",
+		"image":    `{{ index . 0 }}:{{ index . 1 | default "latest" }}`,
+		"label":    "app.example.com/{{ . | kebabCase }}",
+		"endpoint": `https://{{ fqdn . }}`,
+		"loop":     "{{ loop . }}",
+	}
+
+	testCases := []struct {
+		name      string
+		functions map[string]string
+		template  string
+		expected  string
+		errorMsg  string
+	}{
+		{
+			name:      "Map argument as dot",
+			functions: functions,
+			template:  `{{ fqdn (dict "name" "web" "ns" "prod") }}`,
+			expected:  "web.prod.svc.cluster.local",
+		},
+		{
+			name:      "Several arguments as a list",
+			functions: functions,
+			template:  `{{ image "nginx" "" }} {{ image .Name "1.0" }}`,
+			expected:  "nginx:latest web:1.0",
+		},
+		{
+			name:      "Built-in functions and pipelines",
+			functions: functions,
+			template:  `{{ "TeamName" | label }}`,
+			expected:  "app.example.com/team-name",
+		},
+		{
+			name:      "Functions calling each other",
+			functions: functions,
+			template:  `{{ endpoint (dict "name" "api" "ns" "dev") }}`,
+			expected:  "https://api.dev.svc.cluster.local",
+		},
+		{
+			name:      "Recursive function",
+			functions: functions,
+			template:  `{{ loop 1 }}`,
+			errorMsg:  "exceeded maximum nesting depth",
+		},
+		{
+			name:      "Function replacing a built-in function",
+			functions: map[string]string{"upper": "{{ . }}"},
+			template:  `{{ .Name }}`,
+			errorMsg:  `function "upper" from Functions is already defined`,
+		},
+		{
+			name:      "Invalid body",
+			functions: map[string]string{"broken": "{{ .name "},
+			template:  `{{ .Name }}`,
+			errorMsg:  `invalid function "broken" in Functions`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			srcDir := t.TempDir()
+			config.Reset()
+			config.OutputDir = t.TempDir()
+			config.Functions = tc.functions
+			defer config.Reset()
+
+			writeFiles(t, srcDir, map[string]string{
+				"app/data.yaml":        "Name: web",
+				"app/template.go.tmpl": tc.template,
+			})
+
+			output, err := renderTemplateDir(t, srcDir, "app")
+			if tc.errorMsg != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.errorMsg) {
+					t.Errorf("Expected error containing %q, got %v", tc.errorMsg, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ProcessTemplate failed: %v", err)
+			}
+			if strings.TrimSpace(output) != tc.expected {
+				t.Errorf("Expected output %q, got %q", tc.expected, output)
+			}
+		})
+	}
+}
+
+func TestProcessTemplateDataFormats(t *testing.T) {
+	common := `{{ .name }} {{ .port }} {{ add .port 1 }} {{ range .tags }}[{{ . }}]{{ end }}`
+
+	testCases := []struct {
+		name     string
+		file     string
+		content  string
+		template string
+		expected string
+	}{
+		{
+			name:     "YAML",
+			file:     "data.yaml",
+			content:  "name: web\nport: 8080\ntags: [a, b]\n",
+			template: common,
+			expected: "web 8080 8081 [a][b]",
+		},
+		{
+			name:     "YML",
+			file:     "data.yml",
+			content:  "name: web\nport: 8080\ntags: [a, b]\n",
+			template: common,
+			expected: "web 8080 8081 [a][b]",
+		},
+		{
+			name:     "JSON",
+			file:     "data.json",
+			content:  `{"name": "web", "port": 8080, "tags": ["a", "b"]}`,
+			template: common,
+			expected: "web 8080 8081 [a][b]",
+		},
+		{
+			name:     "JSON numbers compare like YAML numbers",
+			file:     "data.json",
+			content:  `{"port": 8080, "ratio": 0.5}`,
+			template: `{{ if eq .port 8080 }}ok{{ end }} {{ .ratio }}`,
+			expected: "ok 0.5",
+		},
+		{
+			name:     "TOML",
+			file:     "data.toml",
+			content:  "name = \"web\"\nport = 8080\ntags = [\"a\", \"b\"]\n",
+			template: common,
+			expected: "web 8080 8081 [a][b]",
+		},
+		{
+			name:     "TOML array of tables",
+			file:     "data.toml",
+			content:  "[[service]]\nname = \"web\"\n\n[[service]]\nname = \"api\"\n",
+			template: `{{ range .service }}{{ .name }} {{ end }}{{ len .service }}`,
+			expected: "web api 2",
+		},
+		{
+			name:     "CSV records",
+			file:     "data.csv",
+			content:  "name,port\nweb,8080\n\"api, v2\",9090\n",
+			template: `{{ range . }}{{ .name }}={{ .port }};{{ end }}`,
+			expected: "web=8080;api, v2=9090;",
+		},
+		{
+			name:     "Dotenv",
+			file:     "data.env",
+			content:  "# settings\nexport NAME=web\nPORT=8080 # http\nGREETING=\"hello\\nworld\"\nRAW='a $b'\n",
+			template: `{{ .NAME }} {{ .PORT }} {{ .GREETING | quote }} {{ .RAW }}`,
+			expected: `web 8080 "hello\nworld" a $b`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			srcDir := t.TempDir()
+			config.Reset()
+			config.OutputDir = t.TempDir()
+			defer config.Reset()
+
+			writeFiles(t, srcDir, map[string]string{
+				"app/" + tc.file:       tc.content,
+				"app/template.go.tmpl": tc.template,
+			})
+
+			output, err := renderTemplateDir(t, srcDir, "app")
+			if err != nil {
+				t.Fatalf("ProcessTemplate failed: %v", err)
+			}
+			if strings.TrimSpace(output) != tc.expected {
+				t.Errorf("Expected output %q, got %q", tc.expected, output)
+			}
+		})
+	}
+}
+
+func TestFindDataFile(t *testing.T) {
+	testCases := []struct {
+		name     string
+		dataFile string
+		files    []string
+		expected string
+		errorMsg string
+	}{
+		{"Default YAML file", "", []string{"data.yaml"}, "data.yaml", ""},
+		{"Other format", "", []string{"data.toml"}, "data.toml", ""},
+		{"Stem of DataFile", "values.json", []string{"values.csv", "data.yaml"}, "values.csv", ""},
+		{"Unsupported extension used as is", "data.txt", []string{"data.txt", "data.yaml"}, "data.txt", ""},
+		{"Ambiguous files", "", []string{"data.yaml", "data.json"}, "", "ambiguous data files"},
+		{"No data file", "", nil, "", "no data file"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+			config.Reset()
+			if tc.dataFile != "" {
+				config.DataFile = tc.dataFile
+			}
+			defer config.Reset()
+
+			for _, name := range tc.files {
+				if err := os.WriteFile(filepath.Join(dir, name), nil, 0644); err != nil {
+					t.Fatalf("Failed to write %s: %v", name, err)
+				}
+			}
+
+			path, err := FindDataFile(dir)
+			if tc.errorMsg != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.errorMsg) {
+					t.Errorf("Expected error containing %q, got %v", tc.errorMsg, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("FindDataFile failed: %v", err)
+			}
+			if filepath.Base(path) != tc.expected {
+				t.Errorf("Expected %s, got %s", tc.expected, filepath.Base(path))
+			}
+		})
+	}
+}
+
+func TestProcessTemplatePerDocument(t *testing.T) {
+	data := "name: web\nport: 80\n---\nname: api\nport: 90\n"
+
+	testCases := []struct {
+		name        string
+		template    string
+		perDocument bool
+		expected    map[string]string
+		errorMsg    string
+	}{
+		{
+			name:     "Only the first document by default",
+			template: "{{ .name }}",
+			expected: map[string]string{"file": "web"},
+		},
+		{
+			name:     "Directive with index directories",
+			template: "# config foreach-doc=true\n{{ .name }}:{{ .port }}",
+			expected: map[string]string{"doc-00/file": "web:80", "doc-01/file": "api:90"},
+		},
+		{
+			name:        "Flag with index directories",
+			template:    "{{ .name }}",
+			perDocument: true,
+			expected:    map[string]string{"doc-00/file": "web", "doc-01/file": "api"},
+		},
+		{
+			name:        "Directive overrides the flag",
+			template:    "# config foreach-doc=false\n{{ .name }}",
+			perDocument: true,
+			expected:    map[string]string{"file": "web"},
+		},
+		{
+			name:     "Directories named by a key",
+			template: "# config foreach-key=name ext=txt\n{{ .port }}",
+			expected: map[string]string{"web/file.txt": "80", "api/file.txt": "90"},
+		},
+		{
+			name:     "Missing key",
+			template: "# config foreach-key=service\n{{ .port }}",
+			errorMsg: `document 0 has no value for key "service"`,
+		},
+		{
+			name:     "Invalid foreach-doc value",
+			template: "# config foreach-doc=yes\n{{ .port }}",
+			errorMsg: `invalid foreach-doc "yes"`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			srcDir := t.TempDir()
+			config.Reset()
+			config.OutputDir = t.TempDir()
+			defer config.Reset()
+
+			writeFiles(t, srcDir, map[string]string{
+				"data.yaml":        data,
+				"template.go.tmpl": tc.template,
+			})
+
+			processor := NewProcessor(false)
+			processor.SetPerDocument(tc.perDocument)
+			err := processor.ProcessTemplate(filepath.Join(srcDir, config.TemplateFile), false)
+			if tc.errorMsg != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.errorMsg) {
+					t.Errorf("Expected error containing %q, got %v", tc.errorMsg, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ProcessTemplate failed: %v", err)
+			}
+
+			for name, expected := range tc.expected {
+				content, err := os.ReadFile(filepath.Join(config.OutputDir, name))
+				if err != nil {
+					t.Fatalf("Failed to read output %s: %v", name, err)
+				}
+				if strings.TrimSpace(string(content)) != expected {
+					t.Errorf("Expected %s to contain %q, got %q", name, expected, content)
+				}
+			}
+		})
+	}
+}
+
+func TestProcessTemplatePerDocumentDuplicateNames(t *testing.T) {
+	srcDir := t.TempDir()
+	config.Reset()
+	config.OutputDir = t.TempDir()
+	defer config.Reset()
+
+	writeFiles(t, srcDir, map[string]string{
+		"data.yaml":        "name: web\n---\nname: web\n",
+		"template.go.tmpl": "# config foreach-key=name\n{{ .name }}",
+	})
+
+	err := NewProcessor(false).ProcessTemplate(filepath.Join(srcDir, config.TemplateFile), false)
+	if err == nil || !strings.Contains(err.Error(), `documents 0 and 1`) {
+		t.Errorf("Expected an error about documents rendering into the same directory, got %v", err)
+	}
+}
+
+func TestProcessTemplateInheritedData(t *testing.T) {
+	files := map[string]string{
+		"data.yaml":                 "org: acme\nimage:\n  registry: registry.acme.io\n  tag: \"1.0\"\n",
+		"team/data.json":            `{"team": "core", "image": {"tag": "2.0"}}`,
+		"team/app/data.yaml":        "name: app\norg: null\n",
+		"team/app/template.go.tmpl": `{{ .name }} {{ .team }} {{ .image.registry }}:{{ .image.tag }} {{ .org | default "none" }}`,
+		"solo/data.yaml":            "name: solo\n",
+		"solo/template.go.tmpl":     `{{ .name }} {{ .org }} {{ .team | default "none" }}`,
+	}
+
+	testCases := []struct {
+		name     string
+		template string
+		multiple bool
+		expected string
+	}{
+		{"Merged from root to leaf", "team/app", true, "app core registry.acme.io:2.0 none"},
+		{"Root data only", "solo", true, "solo acme none"},
+		{"No inheritance in single mode", "solo", false, "solo <no value> none"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			srcDir := t.TempDir()
+			config.Reset()
+			config.OutputDir = t.TempDir()
+			defer config.Reset()
+			writeFiles(t, srcDir, files)
+
+			processor := NewProcessor(false)
+			processor.SetSourceRoot(srcDir)
+			if err := processor.ProcessTemplate(filepath.Join(srcDir, tc.template, config.TemplateFile), tc.multiple); err != nil {
+				t.Fatalf("ProcessTemplate failed: %v", err)
+			}
+
+			outputPath := filepath.Join(config.OutputDir, config.DefaultPrefix)
+			if tc.multiple {
+				outputPath = filepath.Join(config.OutputDir, filepath.Base(tc.template), config.DefaultPrefix)
+			}
+			content, err := os.ReadFile(outputPath)
+			if err != nil {
+				t.Fatalf("Failed to read output: %v", err)
+			}
+			if strings.TrimSpace(string(content)) != tc.expected {
+				t.Errorf("Expected output %q, got %q", tc.expected, content)
+			}
+		})
+	}
+}
+
+func TestShowData(t *testing.T) {
+	srcDir := t.TempDir()
+	config.Reset()
+	config.OutputDir = t.TempDir()
+	defer config.Reset()
+
+	writeFiles(t, srcDir, map[string]string{
+		"data.yaml":             "org: acme\nreplicas: 1\n",
+		"app/data.yaml":         "name: app\n",
+		"app/template.go.tmpl":  "{{ .name }}",
+		"docs/data.yaml":        "name: a\n---\nname: b\n",
+		"docs/template.go.tmpl": "# config foreach-doc=true\n{{ .name }}",
+	})
+
+	processor := NewProcessor(false)
+	processor.SetSourceRoot(srcDir)
+	processor.SetOverrides([]map[string]interface{}{{"replicas": 3}})
+
+	var buf strings.Builder
+	templatePath := filepath.Join(srcDir, "app", config.TemplateFile)
+	if err := processor.ShowData(&buf, templatePath, true); err != nil {
+		t.Fatalf("ShowData failed: %v", err)
+	}
+
+	docsPath := filepath.Join(srcDir, "docs", config.TemplateFile)
+	if err := processor.ShowData(&buf, docsPath, true); err != nil {
+		t.Fatalf("ShowData failed: %v", err)
+	}
+
+	expected := "---\n# Data for " + templatePath + "\nname: app\norg: acme\nreplicas: 3\n" +
+		"---\n# Data for " + docsPath + ", document 0\nname: a\norg: acme\nreplicas: 3\n" +
+		"---\n# Data for " + docsPath + ", document 1\nname: b\norg: acme\nreplicas: 3\n"
+	if buf.String() != expected {
+		t.Errorf("Expected %q, got %q", expected, buf.String())
+	}
+}
+
+func TestProcessTemplateEnvironmentOverlay(t *testing.T) {
+	files := map[string]string{
+		"data.yaml":                "org: acme\nregion: eu\n",
+		"data.prod.yaml":           "region: us\n",
+		"app/data.yaml":            "name: app\nreplicas: 1\nimage:\n  tag: \"1.0\"\n  pull: IfNotPresent\n",
+		"app/data.prod.json":       `{"replicas": 3, "image": {"tag": "2.0"}}`,
+		"app/data.staging.yaml":    "replicas: 2\n",
+		"app/template.go.tmpl":     `{{ .name }} {{ .region }} {{ .replicas }} {{ .image.tag }} {{ .image.pull }}`,
+		"other/data.yaml":          "name: other\n",
+		"other/data.dev.toml":      "name = \"other-dev\"\n",
+		"other/template.go.tmpl":   `{{ .name }}`,
+		"other/notes.txt":          "not an overlay\n",
+		"other/data.bad.name.yaml": "ignored: true\n",
+	}
+
+	testCases := []struct {
+		name     string
+		env      string
+		expected string
+	}{
+		{"No environment", "", "app eu 1 1.0 IfNotPresent"},
+		{"Overlays deep-merged at every level", "prod", "app us 3 2.0 IfNotPresent"},
+		{"Overlay in the template directory only", "staging", "app eu 2 1.0 IfNotPresent"},
+		{"Environment without overlays", "qa", "app eu 1 1.0 IfNotPresent"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			srcDir := t.TempDir()
+			config.Reset()
+			config.OutputDir = t.TempDir()
+			defer config.Reset()
+			writeFiles(t, srcDir, files)
+
+			processor := NewProcessor(false)
+			processor.SetSourceRoot(srcDir)
+			processor.SetEnvironment(tc.env)
+			if err := processor.ProcessTemplate(filepath.Join(srcDir, "app", config.TemplateFile), true); err != nil {
+				t.Fatalf("ProcessTemplate failed: %v", err)
+			}
+
+			content, err := os.ReadFile(filepath.Join(config.OutputDir, "app", config.DefaultPrefix))
+			if err != nil {
+				t.Fatalf("Failed to read output: %v", err)
+			}
+			if strings.TrimSpace(string(content)) != tc.expected {
+				t.Errorf("Expected output %q, got %q", tc.expected, content)
+			}
+		})
+	}
+
+	t.Run("Environments", func(t *testing.T) {
+		srcDir := t.TempDir()
+		config.Reset()
+		defer config.Reset()
+		writeFiles(t, srcDir, files)
+
+		processor := NewProcessor(false)
+		processor.SetSourceRoot(srcDir)
+		templates := []string{
+			filepath.Join(srcDir, "app", config.TemplateFile),
+			filepath.Join(srcDir, "other", config.TemplateFile),
+		}
+
+		environments, err := processor.Environments(templates, true)
+		if err != nil {
+			t.Fatalf("Environments failed: %v", err)
+		}
+		expected := []string{"dev", "prod", "staging"}
+		if !reflect.DeepEqual(environments, expected) {
+			t.Errorf("Expected environments %v, got %v", expected, environments)
+		}
+
+		// Ancestor overlays are only inherited in multiple mode
+		environments, err = processor.Environments(templates[1:], false)
+		if err != nil {
+			t.Fatalf("Environments failed: %v", err)
+		}
+		if !reflect.DeepEqual(environments, []string{"dev"}) {
+			t.Errorf("Expected environments [dev], got %v", environments)
+		}
+	})
+
+	t.Run("Unknown environment", func(t *testing.T) {
+		srcDir := t.TempDir()
+		config.Reset()
+		defer config.Reset()
+		writeFiles(t, srcDir, files)
+
+		processor := NewProcessor(false)
+		processor.SetSourceRoot(srcDir)
+		templates := []string{
+			filepath.Join(srcDir, "app", config.TemplateFile),
+			filepath.Join(srcDir, "other", config.TemplateFile),
+		}
+
+		if err := processor.CheckEnvironment("dev", templates, true); err != nil {
+			t.Errorf("Expected an overlay of one template to be enough, got %v", err)
+		}
+		err := processor.CheckEnvironment("prd", templates, true)
+		expected := "no data.prd overlay found next to the data files; environments with overlays: dev, prod, staging"
+		if err == nil || err.Error() != expected {
+			t.Errorf("Expected error %q, got %v", expected, err)
+		}
+		err = processor.CheckEnvironment("dev", templates[:1], false)
+		if err == nil || !strings.Contains(err.Error(), "environments with overlays: prod, staging") {
+			t.Errorf("Expected an error listing prod and staging, got %v", err)
+		}
+	})
+
+	t.Run("Ambiguous overlays", func(t *testing.T) {
+		srcDir := t.TempDir()
+		config.Reset()
+		config.OutputDir = t.TempDir()
+		defer config.Reset()
+		writeFiles(t, srcDir, map[string]string{
+			"data.yaml":        "name: app\n",
+			"data.prod.yaml":   "name: a\n",
+			"data.prod.json":   `{"name": "b"}`,
+			"template.go.tmpl": "{{ .name }}",
+		})
+
+		processor := NewProcessor(false)
+		processor.SetEnvironment("prod")
+		err := processor.ProcessTemplate(filepath.Join(srcDir, config.TemplateFile), false)
+		if err == nil || !strings.Contains(err.Error(), "ambiguous overlay files") {
+			t.Errorf("Expected ambiguous overlay error, got %v", err)
+		}
+	})
+}
@@ -0,0 +1,1049 @@
+package template
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/mail"
+	"net/netip"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"gopkg.in/yaml.v3"
+)
+
+// schemaFiles are the JSON Schema files looked up next to the data file
+var schemaFiles = []string{"schema.json", "schema.yaml", "schema.yml"}
+
+// schema is a compiled JSON Schema. It supports the validation keywords most useful for
+// data files: type, enum, const, the numeric, string, array and object constraints, the
+// formats of stringFormats, allOf, anyOf, oneOf, not, if, then, else, local $ref and
+// default. Annotations such as title are ignored, and compiling a schema using any other
+// keyword or format fails, so no part of a schema is silently left unchecked.
+type schema struct {
+	// always is set for the boolean schemas true and false
+	always *bool
+
+	types []string
+	enum  []interface{}
+	// constant holds the const value as a one-item list, so that null can be told apart
+	constant []interface{}
+
+	minimum, maximum                   *float64
+	exclusiveMinimum, exclusiveMaximum *float64
+	multipleOf                         *float64
+
+	minLength, maxLength *int
+	pattern              *regexp.Regexp
+	// format names the format of strings, checked by formatCheck
+	format      string
+	formatCheck func(string) bool
+
+	prefixItems        []*schema
+	items              *schema
+	minItems, maxItems *int
+	uniqueItems        bool
+
+	properties           map[string]*schema
+	patternProperties    []patternSchema
+	required             []string
+	dependentRequired    map[string][]string
+	additionalProperties *schema
+	minProperties        *int
+	maxProperties        *int
+
+	allOf, anyOf, oneOf              []*schema
+	not                              *schema
+	ifSchema, thenSchema, elseSchema *schema
+	ref                              *schema
+
+	hasDefault   bool
+	defaultValue interface{}
+}
+
+// patternSchema is a schema of patternProperties, applying to the properties whose name
+// matches its pattern
+type patternSchema struct {
+	pattern *regexp.Regexp
+	schema  *schema
+}
+
+// stringFormats are the supported values of the format keyword, with the check of each one
+var stringFormats = map[string]func(string) bool{
+	"date-time": func(s string) bool { _, err := time.Parse(time.RFC3339, s); return err == nil },
+	"date":      func(s string) bool { _, err := time.Parse(time.DateOnly, s); return err == nil },
+	"time":      func(s string) bool { _, err := time.Parse("15:04:05Z07:00", s); return err == nil },
+	"email":     validEmail,
+	"hostname":  validHostname,
+	"ipv4":      func(s string) bool { ip, err := netip.ParseAddr(s); return err == nil && ip.Is4() },
+	"ipv6":      func(s string) bool { ip, err := netip.ParseAddr(s); return err == nil && ip.Is6() && ip.Zone() == "" },
+	"uri":       func(s string) bool { u, err := url.Parse(s); return err == nil && u.Scheme != "" },
+	"uuid":      uuidPattern.MatchString,
+	"regex":     func(s string) bool { _, err := regexp.Compile(s); return err == nil },
+}
+
+// uuidPattern matches a UUID in its hyphenated form
+var uuidPattern = regexp.MustCompile(`^(?i)[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}$`)
+
+// hostnameLabel matches a label of a host name
+var hostnameLabel = regexp.MustCompile(`^(?i)[a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?$`)
+
+// validEmail reports whether s is a bare email address, without a display name
+func validEmail(s string) bool {
+	addr, err := mail.ParseAddress(s)
+	return err == nil && addr.Name == "" && addr.Address == s
+}
+
+// validHostname reports whether s is a host name made of dot-separated labels
+func validHostname(s string) bool {
+	if s == "" || len(s) > 253 {
+		return false
+	}
+	for _, label := range strings.Split(s, ".") {
+		if !hostnameLabel.MatchString(label) {
+			return false
+		}
+	}
+	return true
+}
+
+// schemaCompiler compiles a schema document, resolving $ref pointers into it
+type schemaCompiler struct {
+	root interface{}
+	refs map[string]*schema
+}
+
+// loadSchema finds and compiles the schema next to a data file. It returns nil when there
+// is none.
+func loadSchema(dir string) (*schema, string, error) {
+	schemaPath, err := findOneOf(dir, "schema", schemaFiles)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, "", nil
+	}
+	if err != nil {
+		return nil, "", err
+	}
+
+	content, err := os.ReadFile(schemaPath)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to read schema: %w", err)
+	}
+	documents, err := decodeDocuments(schemaPath, content, "", nil)
+	if err != nil {
+		return nil, "", fmt.Errorf("schema %s: %w", schemaPath, err)
+	}
+	if len(documents) > 1 {
+		return nil, "", fmt.Errorf("schema %s has %d documents, expected one", schemaPath, len(documents))
+	}
+
+	compiler := &schemaCompiler{root: documents[0], refs: make(map[string]*schema)}
+	compiled, err := compiler.compile(documents[0], "")
+	if err != nil {
+		return nil, "", fmt.Errorf("invalid schema %s: %w", schemaPath, err)
+	}
+	return compiled, schemaPath, nil
+}
+
+// compile compiles the schema found at a JSON pointer of the schema document
+func (c *schemaCompiler) compile(v interface{}, pointer string) (*schema, error) {
+	if b, ok := v.(bool); ok {
+		return &schema{always: &b}, nil
+	}
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%s: a schema must be an object or a boolean", displayPointer(pointer))
+	}
+
+	s := &schema{}
+	var err error
+	fail := func(keyword string, format string, args ...interface{}) error {
+		return fmt.Errorf("%s: %s %s", displayPointer(pointer+"/"+keyword), keyword, fmt.Sprintf(format, args...))
+	}
+
+	// Keywords are compiled in order, so the first unsupported one is always the one reported
+	for _, keyword := range sortedKeys(m) {
+		value := m[keyword]
+		switch keyword {
+		case "type":
+			switch t := value.(type) {
+			case string:
+				s.types = []string{t}
+			case []interface{}:
+				for _, item := range t {
+					name, ok := item.(string)
+					if !ok {
+						return nil, fail(keyword, "must list type names")
+					}
+					s.types = append(s.types, name)
+				}
+			default:
+				return nil, fail(keyword, "must be a type name or a list of them")
+			}
+			for _, name := range s.types {
+				if !validSchemaType(name) {
+					return nil, fail(keyword, "has an unknown type %q", name)
+				}
+			}
+		case "enum":
+			list, ok := value.([]interface{})
+			if !ok {
+				return nil, fail(keyword, "must be a list")
+			}
+			s.enum = list
+		case "const":
+			s.constant = []interface{}{value}
+		case "minimum":
+			s.minimum, err = numberKeyword(keyword, value)
+		case "maximum":
+			s.maximum, err = numberKeyword(keyword, value)
+		case "exclusiveMinimum":
+			s.exclusiveMinimum, err = numberKeyword(keyword, value)
+		case "exclusiveMaximum":
+			s.exclusiveMaximum, err = numberKeyword(keyword, value)
+		case "multipleOf":
+			if s.multipleOf, err = numberKeyword(keyword, value); err == nil && *s.multipleOf <= 0 {
+				err = fmt.Errorf("multipleOf must be greater than 0")
+			}
+		case "minLength":
+			s.minLength, err = countKeyword(keyword, value)
+		case "maxLength":
+			s.maxLength, err = countKeyword(keyword, value)
+		case "minItems":
+			s.minItems, err = countKeyword(keyword, value)
+		case "maxItems":
+			s.maxItems, err = countKeyword(keyword, value)
+		case "minProperties":
+			s.minProperties, err = countKeyword(keyword, value)
+		case "maxProperties":
+			s.maxProperties, err = countKeyword(keyword, value)
+		case "pattern":
+			expr, ok := value.(string)
+			if !ok {
+				return nil, fail(keyword, "must be a string")
+			}
+			if s.pattern, err = regexp.Compile(expr); err != nil {
+				return nil, fail(keyword, "is not a valid regular expression: %v", err)
+			}
+		case "format":
+			name, ok := value.(string)
+			if !ok {
+				return nil, fail(keyword, "must be a string")
+			}
+			if s.formatCheck = stringFormats[name]; s.formatCheck == nil {
+				return nil, fail(keyword, "has an unsupported format %q; use one of %s", name, strings.Join(sortedKeys(stringFormats), ", "))
+			}
+			s.format = name
+		case "uniqueItems":
+			if s.uniqueItems, ok = value.(bool); !ok {
+				return nil, fail(keyword, "must be a boolean")
+			}
+		case "items":
+			if s.items, err = c.compile(value, pointer+"/items"); err != nil {
+				return nil, err
+			}
+		case "prefixItems":
+			list, ok := value.([]interface{})
+			if !ok || len(list) == 0 {
+				return nil, fail(keyword, "must be a non-empty list of schemas")
+			}
+			if s.prefixItems, err = c.compileList(keyword, list, pointer); err != nil {
+				return nil, err
+			}
+		case "additionalProperties":
+			if s.additionalProperties, err = c.compile(value, pointer+"/additionalProperties"); err != nil {
+				return nil, err
+			}
+		case "not":
+			if s.not, err = c.compile(value, pointer+"/not"); err != nil {
+				return nil, err
+			}
+		case "if":
+			if s.ifSchema, err = c.compile(value, pointer+"/if"); err != nil {
+				return nil, err
+			}
+		case "then":
+			if s.thenSchema, err = c.compile(value, pointer+"/then"); err != nil {
+				return nil, err
+			}
+		case "else":
+			if s.elseSchema, err = c.compile(value, pointer+"/else"); err != nil {
+				return nil, err
+			}
+		case "properties":
+			props, ok := value.(map[string]interface{})
+			if !ok {
+				return nil, fail(keyword, "must be an object")
+			}
+			s.properties = make(map[string]*schema, len(props))
+			for name, prop := range props {
+				if s.properties[name], err = c.compile(prop, pointer+"/properties/"+escapePointer(name)); err != nil {
+					return nil, err
+				}
+			}
+		case "patternProperties":
+			props, ok := value.(map[string]interface{})
+			if !ok {
+				return nil, fail(keyword, "must be an object")
+			}
+			for _, expr := range sortedKeys(props) {
+				re, err := regexp.Compile(expr)
+				if err != nil {
+					return nil, fail(keyword, "has an invalid regular expression %q: %v", expr, err)
+				}
+				compiled, err := c.compile(props[expr], pointer+"/patternProperties/"+escapePointer(expr))
+				if err != nil {
+					return nil, err
+				}
+				s.patternProperties = append(s.patternProperties, patternSchema{pattern: re, schema: compiled})
+			}
+		case "required":
+			if s.required, ok = stringList(value); !ok {
+				return nil, fail(keyword, "must be a list of property names")
+			}
+		case "dependentRequired":
+			deps, ok := value.(map[string]interface{})
+			if !ok {
+				return nil, fail(keyword, "must be an object")
+			}
+			s.dependentRequired = make(map[string][]string, len(deps))
+			for name, list := range deps {
+				if s.dependentRequired[name], ok = stringList(list); !ok {
+					return nil, fail(keyword, "must map property names to lists of property names")
+				}
+			}
+		case "allOf", "anyOf", "oneOf":
+			list, ok := value.([]interface{})
+			if !ok || len(list) == 0 {
+				return nil, fail(keyword, "must be a non-empty list of schemas")
+			}
+			compiled, err := c.compileList(keyword, list, pointer)
+			if err != nil {
+				return nil, err
+			}
+			switch keyword {
+			case "allOf":
+				s.allOf = compiled
+			case "anyOf":
+				s.anyOf = compiled
+			default:
+				s.oneOf = compiled
+			}
+		case "$ref":
+			ref, ok := value.(string)
+			if !ok {
+				return nil, fail(keyword, "must be a string")
+			}
+			if s.ref, err = c.resolve(ref); err != nil {
+				return nil, fmt.Errorf("%s: %w", displayPointer(pointer+"/$ref"), err)
+			}
+		case "default":
+			s.hasDefault = true
+			s.defaultValue = value
+		case "$schema", "$id", "$comment", "$defs", "definitions",
+			"title", "description", "examples", "deprecated", "readOnly", "writeOnly":
+			// Annotations and the definitions $ref points into don't constrain the data
+		default:
+			return nil, fmt.Errorf("%s: unsupported keyword %q", displayPointer(pointer+"/"+escapePointer(keyword)), keyword)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", displayPointer(pointer+"/"+keyword), err)
+		}
+	}
+	return s, nil
+}
+
+// compileList compiles the list of schemas of allOf, anyOf or oneOf
+func (c *schemaCompiler) compileList(keyword string, list []interface{}, pointer string) ([]*schema, error) {
+	compiled := make([]*schema, len(list))
+	for i, item := range list {
+		var err error
+		if compiled[i], err = c.compile(item, fmt.Sprintf("%s/%s/%d", pointer, keyword, i)); err != nil {
+			return nil, err
+		}
+	}
+	return compiled, nil
+}
+
+// stringList reads a list of strings, such as property names
+func stringList(value interface{}) ([]string, bool) {
+	list, ok := value.([]interface{})
+	if !ok {
+		return nil, false
+	}
+	names := make([]string, 0, len(list))
+	for _, item := range list {
+		name, ok := item.(string)
+		if !ok {
+			return nil, false
+		}
+		names = append(names, name)
+	}
+	return names, true
+}
+
+// numberKeyword reads the value of a numeric keyword
+func numberKeyword(keyword string, value interface{}) (*float64, error) {
+	n, ok := schemaNumber(value)
+	if !ok {
+		return nil, fmt.Errorf("%s must be a number", keyword)
+	}
+	return &n, nil
+}
+
+// countKeyword reads the value of a length or count keyword
+func countKeyword(keyword string, value interface{}) (*int, error) {
+	n, ok := value.(int)
+	if !ok || n < 0 {
+		return nil, fmt.Errorf("%s must be a non-negative integer", keyword)
+	}
+	return &n, nil
+}
+
+// resolve compiles the schema a local $ref points to. Compiled references are cached
+// before they are filled in, so recursive schemas terminate.
+func (c *schemaCompiler) resolve(ref string) (*schema, error) {
+	if compiled, ok := c.refs[ref]; ok {
+		return compiled, nil
+	}
+	if !strings.HasPrefix(ref, "#") {
+		return nil, fmt.Errorf("only local references (#/...) are supported, got %q", ref)
+	}
+
+	pointer := strings.TrimPrefix(ref, "#")
+	if pointer != "" && !strings.HasPrefix(pointer, "/") {
+		return nil, fmt.Errorf("invalid reference %q", ref)
+	}
+	target, ok := pointerValue(c.root, pointer)
+	if !ok {
+		return nil, fmt.Errorf("reference %q not found", ref)
+	}
+
+	compiled := &schema{}
+	c.refs[ref] = compiled
+	result, err := c.compile(target, pointer)
+	if err != nil {
+		return nil, err
+	}
+	*compiled = *result
+	return compiled, nil
+}
+
+// pointerValue returns the value at a JSON pointer of a decoded document
+func pointerValue(v interface{}, pointer string) (interface{}, bool) {
+	if pointer == "" {
+		return v, true
+	}
+	for _, token := range strings.Split(strings.TrimPrefix(pointer, "/"), "/") {
+		token = strings.NewReplacer("~1", "/", "~0", "~").Replace(token)
+		switch node := v.(type) {
+		case map[string]interface{}:
+			var exists bool
+			if v, exists = node[token]; !exists {
+				return nil, false
+			}
+		case []interface{}:
+			i, err := strconv.Atoi(token)
+			if err != nil || i < 0 || i >= len(node) {
+				return nil, false
+			}
+			v = node[i]
+		default:
+			return nil, false
+		}
+	}
+	return v, true
+}
+
+// validSchemaType reports whether name is a JSON Schema type
+func validSchemaType(name string) bool {
+	switch name {
+	case "null", "boolean", "object", "array", "number", "integer", "string":
+		return true
+	}
+	return false
+}
+
+// schemaError is a validation failure at a JSON pointer of the data. atKey is set when the
+// failure is about the key of the value rather than the value itself.
+type schemaError struct {
+	pointer string
+	message string
+	atKey   bool
+}
+
+// validate checks a value against the schema and returns the value with the defaults of
+// missing properties filled in. Defaults are only filled in when fill is set, which is not
+// the case for the branches of anyOf, oneOf and not, so a failed branch leaves no trace.
+func (s *schema) validate(value interface{}, pointer string, fill bool) (interface{}, []schemaError) {
+	if s.always != nil {
+		if *s.always {
+			return value, nil
+		}
+		return value, []schemaError{{pointer: pointer, message: "no value is allowed here"}}
+	}
+
+	var errs []schemaError
+	report := func(format string, args ...interface{}) {
+		errs = append(errs, schemaError{pointer: pointer, message: fmt.Sprintf(format, args...)})
+	}
+
+	if s.ref != nil {
+		var refErrs []schemaError
+		value, refErrs = s.ref.validate(value, pointer, fill)
+		errs = append(errs, refErrs...)
+	}
+
+	// Defaults are filled in first, so required properties may come from them
+	if m, ok := value.(map[string]interface{}); ok && fill {
+		for _, name := range sortedKeys(s.properties) {
+			if prop := s.properties[name]; prop.hasDefault {
+				if _, exists := m[name]; !exists {
+					setKey(m, name, copyValue(prop.defaultValue))
+				}
+			}
+		}
+	}
+
+	kind := schemaType(value)
+	if len(s.types) > 0 && !matchesType(kind, value, s.types) {
+		report("expected %s, got %s", strings.Join(s.types, " or "), kind)
+		return value, errs
+	}
+
+	if len(s.enum) > 0 {
+		found := false
+		for _, allowed := range s.enum {
+			if jsonEqual(value, allowed) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			report("value is not one of %s", formatJSON(s.enum))
+		}
+	}
+	if len(s.constant) > 0 && !jsonEqual(value, s.constant[0]) {
+		report("value is not %s", formatJSON(s.constant[0]))
+	}
+
+	switch v := value.(type) {
+	case string:
+		errs = append(errs, s.validateString(v, pointer)...)
+	case map[string]interface{}:
+		errs = append(errs, s.validateObject(v, pointer, fill)...)
+	case []interface{}:
+		errs = append(errs, s.validateArray(v, pointer, fill)...)
+	default:
+		if n, ok := schemaNumber(value); ok {
+			errs = append(errs, s.validateNumber(n, pointer)...)
+		}
+	}
+
+	for _, sub := range s.allOf {
+		var subErrs []schemaError
+		value, subErrs = sub.validate(value, pointer, fill)
+		errs = append(errs, subErrs...)
+	}
+	if len(s.anyOf) > 0 {
+		matched := false
+		for _, sub := range s.anyOf {
+			if _, subErrs := sub.validate(value, pointer, false); len(subErrs) == 0 {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			report("value doesn't match any of the anyOf schemas")
+		}
+	}
+	if len(s.oneOf) > 0 {
+		matches := 0
+		for _, sub := range s.oneOf {
+			if _, subErrs := sub.validate(value, pointer, false); len(subErrs) == 0 {
+				matches++
+			}
+		}
+		if matches != 1 {
+			report("value matches %d of the oneOf schemas, expected exactly one", matches)
+		}
+	}
+	if s.not != nil {
+		if _, subErrs := s.not.validate(value, pointer, false); len(subErrs) == 0 {
+			report("value must not match the schema of not")
+		}
+	}
+	if s.ifSchema != nil {
+		branch := s.elseSchema
+		if _, ifErrs := s.ifSchema.validate(value, pointer, false); len(ifErrs) == 0 {
+			branch = s.thenSchema
+		}
+		if branch != nil {
+			var branchErrs []schemaError
+			value, branchErrs = branch.validate(value, pointer, fill)
+			errs = append(errs, branchErrs...)
+		}
+	}
+
+	return value, errs
+}
+
+// validateString checks the string constraints
+func (s *schema) validateString(value, pointer string) []schemaError {
+	var errs []schemaError
+	length := utf8.RuneCountInString(value)
+	if s.minLength != nil && length < *s.minLength {
+		errs = append(errs, schemaError{pointer: pointer, message: fmt.Sprintf("string is shorter than %d characters", *s.minLength)})
+	}
+	if s.maxLength != nil && length > *s.maxLength {
+		errs = append(errs, schemaError{pointer: pointer, message: fmt.Sprintf("string is longer than %d characters", *s.maxLength)})
+	}
+	if s.pattern != nil && !s.pattern.MatchString(value) {
+		errs = append(errs, schemaError{pointer: pointer, message: fmt.Sprintf("string doesn't match pattern %q", s.pattern)})
+	}
+	if s.formatCheck != nil && !s.formatCheck(value) {
+		errs = append(errs, schemaError{pointer: pointer, message: fmt.Sprintf("string is not a valid %s", s.format)})
+	}
+	return errs
+}
+
+// validateNumber checks the numeric constraints
+func (s *schema) validateNumber(n float64, pointer string) []schemaError {
+	var errs []schemaError
+	check := func(failed bool, format string, bound float64) {
+		if failed {
+			errs = append(errs, schemaError{pointer: pointer, message: fmt.Sprintf(format, formatNumber(bound))})
+		}
+	}
+	if s.minimum != nil {
+		check(n < *s.minimum, "value is less than the minimum %s", *s.minimum)
+	}
+	if s.maximum != nil {
+		check(n > *s.maximum, "value is greater than the maximum %s", *s.maximum)
+	}
+	if s.exclusiveMinimum != nil {
+		check(n <= *s.exclusiveMinimum, "value is not greater than %s", *s.exclusiveMinimum)
+	}
+	if s.exclusiveMaximum != nil {
+		check(n >= *s.exclusiveMaximum, "value is not less than %s", *s.exclusiveMaximum)
+	}
+	if s.multipleOf != nil {
+		quotient := n / *s.multipleOf
+		check(math.Abs(quotient-math.Round(quotient)) > 1e-9, "value is not a multiple of %s", *s.multipleOf)
+	}
+	return errs
+}
+
+// validateArray checks the array constraints and validates every item
+func (s *schema) validateArray(items []interface{}, pointer string, fill bool) []schemaError {
+	var errs []schemaError
+	if s.minItems != nil && len(items) < *s.minItems {
+		errs = append(errs, schemaError{pointer: pointer, message: fmt.Sprintf("list has fewer than %d items", *s.minItems)})
+	}
+	if s.maxItems != nil && len(items) > *s.maxItems {
+		errs = append(errs, schemaError{pointer: pointer, message: fmt.Sprintf("list has more than %d items", *s.maxItems)})
+	}
+	if s.uniqueItems {
+		for i := range items {
+			for j := 0; j < i; j++ {
+				if jsonEqual(items[i], items[j]) {
+					errs = append(errs, schemaError{pointer: pointer, message: fmt.Sprintf("items %d and %d are equal", j, i)})
+				}
+			}
+		}
+	}
+	// The items after those of prefixItems are checked against items
+	for i, item := range items {
+		sub := s.items
+		if i < len(s.prefixItems) {
+			sub = s.prefixItems[i]
+		}
+		if sub == nil {
+			continue
+		}
+		var itemErrs []schemaError
+		items[i], itemErrs = sub.validate(item, pointer+"/"+strconv.Itoa(i), fill)
+		errs = append(errs, itemErrs...)
+	}
+	return errs
+}
+
+// validateObject checks the object constraints and validates every property
+func (s *schema) validateObject(m map[string]interface{}, pointer string, fill bool) []schemaError {
+	var errs []schemaError
+	if s.minProperties != nil && len(m) < *s.minProperties {
+		errs = append(errs, schemaError{pointer: pointer, message: fmt.Sprintf("object has fewer than %d properties", *s.minProperties)})
+	}
+	if s.maxProperties != nil && len(m) > *s.maxProperties {
+		errs = append(errs, schemaError{pointer: pointer, message: fmt.Sprintf("object has more than %d properties", *s.maxProperties)})
+	}
+	for _, name := range s.required {
+		if _, exists := m[name]; !exists {
+			errs = append(errs, schemaError{pointer: pointer, message: fmt.Sprintf("missing required property %q", name)})
+		}
+	}
+	for _, name := range sortedKeys(s.dependentRequired) {
+		if _, exists := m[name]; !exists {
+			continue
+		}
+		for _, dependency := range s.dependentRequired[name] {
+			if _, exists := m[dependency]; !exists {
+				errs = append(errs, schemaError{pointer: pointer, message: fmt.Sprintf("property %q requires property %q", name, dependency)})
+			}
+		}
+	}
+
+	for _, name := range sortedKeys(m) {
+		propPointer := pointer + "/" + escapePointer(name)
+
+		// A property is checked against its declared schema and those of the patterns it
+		// matches, and against additionalProperties when there is none
+		var applied []*schema
+		if prop, declared := s.properties[name]; declared {
+			applied = append(applied, prop)
+		}
+		for _, p := range s.patternProperties {
+			if p.pattern.MatchString(name) {
+				applied = append(applied, p.schema)
+			}
+		}
+		if len(applied) == 0 {
+			prop := s.additionalProperties
+			if prop == nil {
+				continue
+			}
+			if prop.always != nil && !*prop.always {
+				message := fmt.Sprintf("unexpected property %q", name)
+				if suggestion := closestName(name, sortedKeys(s.properties)); suggestion != "" {
+					message += fmt.Sprintf(" (did you mean %q?)", suggestion)
+				}
+				errs = append(errs, schemaError{pointer: propPointer, message: message, atKey: true})
+				continue
+			}
+			applied = append(applied, prop)
+		}
+
+		for _, prop := range applied {
+			var propErrs []schemaError
+			m[name], propErrs = prop.validate(m[name], propPointer, fill)
+			errs = append(errs, propErrs...)
+		}
+	}
+	return errs
+}
+
+// schemaType returns the JSON Schema type of a decoded value
+func schemaType(value interface{}) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case map[string]interface{}:
+		return "object"
+	case []interface{}:
+		return "array"
+	}
+	if n, ok := schemaNumber(value); ok {
+		if n == math.Trunc(n) && !math.IsInf(n, 0) {
+			return "integer"
+		}
+		return "number"
+	}
+	return fmt.Sprintf("%T", value)
+}
+
+// matchesType reports whether a value of the given kind matches one of the types. Integers
+// are numbers too.
+func matchesType(kind string, value interface{}, types []string) bool {
+	for _, t := range types {
+		if t == kind || t == "number" && kind == "integer" {
+			return true
+		}
+	}
+	return false
+}
+
+// schemaNumber returns the value of a decoded number. Unlike toFloat it doesn't parse
+// strings, as "1" is not a number for a schema.
+func schemaNumber(value interface{}) (float64, bool) {
+	rv := reflect.ValueOf(value)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(rv.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(rv.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return rv.Float(), true
+	}
+	return 0, false
+}
+
+// jsonEqual compares two decoded values the way JSON Schema does: numbers by value,
+// whatever their Go type, and objects and lists item by item
+func jsonEqual(a, b interface{}) bool {
+	if x, ok := schemaNumber(a); ok {
+		y, ok := schemaNumber(b)
+		return ok && x == y
+	}
+	switch x := a.(type) {
+	case map[string]interface{}:
+		y, ok := b.(map[string]interface{})
+		if !ok || len(x) != len(y) {
+			return false
+		}
+		for key, value := range x {
+			other, exists := y[key]
+			if !exists || !jsonEqual(value, other) {
+				return false
+			}
+		}
+		return true
+	case []interface{}:
+		y, ok := b.([]interface{})
+		if !ok || len(x) != len(y) {
+			return false
+		}
+		for i := range x {
+			if !jsonEqual(x[i], y[i]) {
+				return false
+			}
+		}
+		return true
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+// formatJSON formats a value for an error message
+func formatJSON(value interface{}) string {
+	out, err := toJSON(jsonCompatible(value))
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+	return out
+}
+
+// formatNumber formats a number without a needless fraction
+func formatNumber(n float64) string {
+	return strconv.FormatFloat(n, 'g', -1, 64)
+}
+
+// escapePointer escapes a key for use as a JSON pointer token
+func escapePointer(key string) string {
+	return strings.NewReplacer("~", "~0", "/", "~1").Replace(key)
+}
+
+// displayPointer returns a JSON pointer as shown in messages, where the root is "/"
+func displayPointer(pointer string) string {
+	if pointer == "" {
+		return "/"
+	}
+	return pointer
+}
+
+// sortedKeys returns the keys of a map in order
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// closestName returns the candidate closest to name, when it is close enough to be a
+// likely typo
+func closestName(name string, candidates []string) string {
+	best, bestDistance := "", 3
+	for _, candidate := range candidates {
+		if d := editDistance(name, candidate); d < bestDistance {
+			best, bestDistance = candidate, d
+		}
+	}
+	return best
+}
+
+// editDistance returns the Levenshtein distance between two strings
+func editDistance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	previous := make([]int, len(rb)+1)
+	current := make([]int, len(rb)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		current[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous, current = current, previous
+	}
+	return previous[len(rb)]
+}
+
+// position is a line and column in a data file
+type position struct {
+	file         string
+	line, column int
+}
+
+// displayFile returns the name of the file of a position for errors: relative to the
+// directory of the data file, so the data file itself is shown by its base name
+func displayFile(dataPath, file string) string {
+	dir, err := filepath.Abs(filepath.Dir(dataPath))
+	if err != nil {
+		return file
+	}
+	if abs, err := filepath.Abs(file); err == nil {
+		if rel, err := filepath.Rel(dir, abs); err == nil {
+			return rel
+		}
+	}
+	return file
+}
+
+// documentPositions holds the positions of the values of a data document, and of the keys
+// of mapping entries, by JSON pointer
+type documentPositions struct {
+	values map[string]position
+	keys   map[string]position
+}
+
+// fromFile reports whether the value a schema error refers to comes from the data file: the
+// file sets it, and nothing merged over the file's documents changed it. It is given the
+// file's own document and the merged one, before the schema defaults were filled in.
+func fromFile(fileDocument, merged interface{}, e schemaError) bool {
+	fileValue, ok := pointerValue(fileDocument, e.pointer)
+	if !ok {
+		return false
+	}
+	if e.atKey {
+		return true
+	}
+	value, ok := pointerValue(merged, e.pointer)
+	return ok && jsonEqual(fileValue, value)
+}
+
+// lookup returns the position a schema error refers to
+func (d documentPositions) lookup(e schemaError) (position, bool) {
+	if e.atKey {
+		if pos, ok := d.keys[e.pointer]; ok {
+			return pos, true
+		}
+	}
+	pos, ok := d.values[e.pointer]
+	return pos, ok
+}
+
+// dataPositions returns the positions of each document of a YAML or JSON data file, read
+// from its nodes once the custom tags are resolved, so values included from other files
+// point at those files. It returns nil for other formats and data templates, or when the
+// file can't be parsed as YAML.
+func (p *TemplateProcessor) dataPositions(dataPath string) []documentPositions {
+	switch strings.ToLower(filepath.Ext(dataPath)) {
+	case ".toml", ".csv", ".env", dataTemplateExt:
+		return nil
+	}
+	content, err := os.ReadFile(dataPath)
+	if err != nil {
+		return nil
+	}
+	nodes, files, err := parseDataNodes(dataPath, content, p.rootDir(dataPath), p.secrets)
+	if err != nil {
+		return nil
+	}
+
+	documents := make([]documentPositions, len(nodes))
+	for i, node := range nodes {
+		documents[i] = documentPositions{values: make(map[string]position), keys: make(map[string]position)}
+		if len(node.Content) > 0 {
+			documents[i].record(node.Content[0], "", dataPath, files)
+		}
+	}
+	return documents
+}
+
+// record records the position of a node and of everything below it. Nodes come from file
+// unless files lists them.
+func (d documentPositions) record(node *yaml.Node, pointer, file string, files nodeFiles) {
+	for node.Kind == yaml.AliasNode && node.Alias != nil {
+		node = node.Alias
+	}
+	file = files.file(node, file)
+	d.values[pointer] = position{file, node.Line, node.Column}
+
+	switch node.Kind {
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key := node.Content[i]
+			keyPointer := pointer + "/" + escapePointer(key.Value)
+			d.keys[keyPointer] = position{files.file(key, file), key.Line, key.Column}
+			d.record(node.Content[i+1], keyPointer, file, files)
+		}
+	case yaml.SequenceNode:
+		for i, item := range node.Content {
+			d.record(item, pointer+"/"+strconv.Itoa(i), file, files)
+		}
+	}
+}
+
+// validateDocuments validates the data documents of a template against the schema next to
+// its data file, filling in the schema defaults. All errors are reported at once, each with
+// its JSON pointer and, when the value comes from the data file, its line and column.
+// fileDocuments holds the documents of the data file before anything was merged into them.
+func (p *TemplateProcessor) validateDocuments(documents, fileDocuments []interface{}, templatePath, dataPath string) error {
+	s, schemaPath, err := loadSchema(filepath.Dir(templatePath))
+	if err != nil || s == nil {
+		return err
+	}
+	logf("Validating data against schema: %s\n", schemaPath)
+
+	var lines []string
+	var positions []documentPositions
+	for i, document := range documents {
+		// validate fills the defaults in place, so the merged document is kept to find out
+		// which values the data file set
+		merged := copyValue(document)
+		var errs []schemaError
+		documents[i], errs = s.validate(document, "", true)
+		if len(errs) == 0 {
+			continue
+		}
+		if positions == nil {
+			positions = p.dataPositions(dataPath)
+		}
+
+		sort.SliceStable(errs, func(a, b int) bool { return errs[a].pointer < errs[b].pointer })
+		for _, e := range errs {
+			line := fmt.Sprintf("%s: %s", displayPointer(e.pointer), e.message)
+			if i < len(positions) && i < len(fileDocuments) && fromFile(fileDocuments[i], merged, e) {
+				if pos, ok := positions[i].lookup(e); ok && pos.line > 0 {
+					line += fmt.Sprintf(" (%s:%d:%d)", displayFile(dataPath, pos.file), pos.line, pos.column)
+				}
+			}
+			if len(documents) > 1 {
+				line = fmt.Sprintf("document %d: %s", i, line)
+			}
+			lines = append(lines, line)
+		}
+	}
+
+	if len(lines) > 0 {
+		// Keys of the data show in the pointers and messages, and may be decrypted values
+		return p.secrets.redactError(fmt.Errorf("data in %s doesn't match schema %s:\n  %s", dataPath, schemaPath, strings.Join(lines, "\n  ")))
+	}
+	return nil
+}
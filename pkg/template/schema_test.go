@@ -0,0 +1,350 @@
+package template
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/Samet-MohamedAmin/gotmpl/pkg/config"
+)
+
+// compileSchema compiles a schema written in YAML
+func compileSchema(t *testing.T, content string) *schema {
+	t.Helper()
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"schema.yaml": content})
+	s, _, err := loadSchema(dir)
+	if err != nil {
+		t.Fatalf("Failed to load schema: %v", err)
+	}
+	return s
+}
+
+func TestSchemaValidate(t *testing.T) {
+	s := compileSchema(t, `
+$schema: https://json-schema.org/draft/2020-12/schema
+title: App
+type: object
+required: [name]
+additionalProperties: false
+properties:
+  name: {type: string, minLength: 2, pattern: "^[a-z-]+$"}
+  replicas: {type: integer, minimum: 1, maximum: 10}
+  ratio: {type: number, exclusiveMaximum: 1}
+  mode: {enum: [fast, safe]}
+  version: {const: 2}
+  tags: {type: array, items: {type: string}, uniqueItems: true, maxItems: 3}
+  port: {anyOf: [{type: integer}, {type: string, pattern: "^[0-9]+$"}]}
+  contact:
+    type: object
+    properties:
+      email: {format: email}
+      host: {format: hostname}
+      addr: {format: ipv4}
+      created: {format: date-time}
+      id: {format: uuid}
+      site: {format: uri}
+  size: {oneOf: [{type: integer, multipleOf: 2}, {type: integer, multipleOf: 3}]}
+  node: {$ref: "#/$defs/node"}
+  labels: {type: object, patternProperties: {"^x_": {type: string}}, additionalProperties: false}
+  point: {type: array, prefixItems: [{type: string}, {type: integer}], items: false}
+  tls: {type: object, dependentRequired: {cert: [key]}}
+  service:
+    type: object
+    if: {properties: {type: {const: LoadBalancer}}}
+    then: {required: [ip]}
+    else: {properties: {ip: false}}
+$defs:
+  node:
+    type: [object, "null"]
+    properties:
+      child: {$ref: "#/$defs/node"}
+      value: {type: integer}
+`)
+
+	testCases := []struct {
+		name     string
+		data     string
+		expected []string
+	}{
+		{"Valid data", `{name: web, replicas: 3, ratio: 0.5, mode: fast, version: 2, tags: [a, b], port: "80", size: 4}`, nil},
+		{"Wrong root type", `[web]`, []string{"/: expected object, got array"}},
+		{"Missing required property", `{replicas: 3}`, []string{`/: missing required property "name"`}},
+		{"Unexpected property", `{name: web, replcas: 3}`, []string{`/replcas: unexpected property "replcas" (did you mean "replicas"?)`}},
+		{"Wrong type", `{name: web, replicas: "3"}`, []string{"/replicas: expected integer, got string"}},
+		{"Integer is a number", `{name: web, ratio: 0}`, nil},
+		{"Float is not an integer", `{name: web, replicas: 1.5}`, []string{"/replicas: expected integer, got number"}},
+		{"Numeric bounds", `{name: web, replicas: 11, ratio: 1}`, []string{
+			"/ratio: value is not less than 1",
+			"/replicas: value is greater than the maximum 10",
+		}},
+		{"String constraints", `{name: W}`, []string{
+			"/name: string is shorter than 2 characters",
+			`/name: string doesn't match pattern "^[a-z-]+$"`,
+		}},
+		{"Enum and const", `{name: web, mode: slow, version: 3}`, []string{
+			`/mode: value is not one of ["fast","safe"]`,
+			"/version: value is not 2",
+		}},
+		{"Array constraints", `{name: web, tags: [a, a, 1, b]}`, []string{
+			"/tags: list has more than 3 items",
+			"/tags: items 0 and 1 are equal",
+			"/tags/2: expected string, got integer",
+		}},
+		{"anyOf", `{name: web, port: http}`, []string{"/port: value doesn't match any of the anyOf schemas"}},
+		{"oneOf", `{name: web, size: 6}`, []string{"/size: value matches 2 of the oneOf schemas, expected exactly one"}},
+		{"Recursive reference", `{name: web, node: {child: {child: {value: x}}}}`, []string{
+			"/node/child/child/value: expected integer, got string",
+		}},
+		{"Valid conditional keywords", `{name: web, labels: {x_a: b}, point: [a, 1], tls: {cert: c, key: k}, service: {type: LoadBalancer, ip: 10.0.0.1}}`, nil},
+		{"patternProperties", `{name: web, labels: {x_a: 1, y: b}}`, []string{
+			"/labels/x_a: expected string, got integer",
+			`/labels/y: unexpected property "y"`,
+		}},
+		{"prefixItems", `{name: web, point: [1, a, b]}`, []string{
+			"/point/0: expected string, got integer",
+			"/point/1: expected integer, got string",
+			"/point/2: no value is allowed here",
+		}},
+		{"Valid formats", `{name: web, contact: {email: ops@acme.io, host: web-1.acme.io, addr: 10.0.0.1, created: "2024-05-01T10:00:00Z", id: 123e4567-e89b-12d3-a456-426614174000, site: "https://acme.io"}}`, nil},
+		{"Invalid formats", `{name: web, contact: {email: "Ops <ops@acme.io>", host: -web, addr: "::1", created: "2024-05-01", id: 123, site: acme.io}}`, []string{
+			"/contact/addr: string is not a valid ipv4",
+			"/contact/created: string is not a valid date-time",
+			"/contact/email: string is not a valid email",
+			"/contact/host: string is not a valid hostname",
+			"/contact/site: string is not a valid uri",
+		}},
+		{"dependentRequired", `{name: web, tls: {cert: c}}`, []string{`/tls: property "cert" requires property "key"`}},
+		{"if and then", `{name: web, service: {type: LoadBalancer}}`, []string{`/service: missing required property "ip"`}},
+		{"if and else", `{name: web, service: {type: ClusterIP, ip: 10.0.0.1}}`, []string{"/service/ip: no value is allowed here"}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			documents, err := decodeDocuments("data.yaml", []byte(tc.data), "", nil)
+			if err != nil {
+				t.Fatalf("Failed to decode data: %v", err)
+			}
+
+			_, errs := s.validate(documents[0], "", true)
+			var got []string
+			for _, e := range errs {
+				got = append(got, displayPointer(e.pointer)+": "+e.message)
+			}
+			if !reflect.DeepEqual(sortedStrings(got), sortedStrings(tc.expected)) {
+				t.Errorf("Expected errors %q, got %q", tc.expected, got)
+			}
+		})
+	}
+}
+
+// sortedStrings returns a sorted copy of a list
+func sortedStrings(list []string) []string {
+	sorted := append([]string(nil), list...)
+	sort.Strings(sorted)
+	return sorted
+}
+
+func TestSchemaDefaults(t *testing.T) {
+	s := compileSchema(t, `
+type: object
+required: [replicas]
+properties:
+  replicas: {type: integer, default: 1}
+  image:
+    type: object
+    default: {}
+    properties:
+      pull: {default: IfNotPresent}
+      tag: {type: string, default: latest}
+  ports:
+    type: array
+    items:
+      type: object
+      properties:
+        protocol: {default: TCP}
+  mode:
+    anyOf:
+      - {type: object, properties: {fast: {default: true}}}
+`)
+
+	data := map[string]interface{}{
+		"image": map[string]interface{}{"tag": "1.0"},
+		"ports": []interface{}{map[string]interface{}{"port": 80}, map[string]interface{}{"protocol": "UDP"}},
+		"mode":  map[string]interface{}{},
+	}
+	value, errs := s.validate(data, "", true)
+	if len(errs) > 0 {
+		t.Fatalf("Expected no errors, got %v", errs)
+	}
+
+	expected := map[string]interface{}{
+		"replicas": 1,
+		"image":    map[string]interface{}{"tag": "1.0", "pull": "IfNotPresent"},
+		"ports": []interface{}{
+			map[string]interface{}{"port": 80, "protocol": "TCP"},
+			map[string]interface{}{"protocol": "UDP"},
+		},
+		"mode": map[string]interface{}{},
+	}
+	if !reflect.DeepEqual(value, expected) {
+		t.Errorf("Expected %v, got %v", expected, value)
+	}
+
+	// A default object is filled in, then its own defaults
+	value, _ = s.validate(map[string]interface{}{}, "", true)
+	image := value.(map[string]interface{})["image"]
+	if !reflect.DeepEqual(image, map[string]interface{}{"pull": "IfNotPresent", "tag": "latest"}) {
+		t.Errorf("Expected the defaults of the default image, got %v", image)
+	}
+}
+
+func TestLoadSchemaErrors(t *testing.T) {
+	testCases := []struct {
+		name     string
+		files    map[string]string
+		expected string
+	}{
+		{"Unknown type", map[string]string{"schema.yaml": "type: text\n"}, `/type: type has an unknown type "text"`},
+		{"Invalid pattern", map[string]string{"schema.yaml": "pattern: \"[\"\n"}, "/pattern: pattern is not a valid regular expression"},
+		{"Invalid nested schema", map[string]string{"schema.yaml": "properties:\n  name: 3\n"}, "/properties/name: a schema must be an object or a boolean"},
+		{"Missing reference", map[string]string{"schema.yaml": "$ref: \"#/$defs/none\"\n"}, `/$ref: reference "#/$defs/none" not found`},
+		{"Remote reference", map[string]string{"schema.json": `{"$ref": "https://example.com/schema.json"}`}, "only local references"},
+		{"Negative length", map[string]string{"schema.yaml": "minLength: -1\n"}, "/minLength: minLength must be a non-negative integer"},
+		{"Unsupported keyword", map[string]string{"schema.yaml": "properties:\n  name: {propertyNames: {maxLength: 3}}\n"}, `/properties/name/propertyNames: unsupported keyword "propertyNames"`},
+		{"Unknown keyword", map[string]string{"schema.yaml": "requried: [name]\n"}, `/requried: unsupported keyword "requried"`},
+		{"Unsupported format", map[string]string{"schema.yaml": "format: iri\n"}, `/format: format has an unsupported format "iri"; use one of date, date-time`},
+		{"Ambiguous schemas", map[string]string{"schema.yaml": "{}", "schema.json": "{}"}, "ambiguous schema files"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeFiles(t, dir, tc.files)
+			_, _, err := loadSchema(dir)
+			if err == nil || !strings.Contains(err.Error(), tc.expected) {
+				t.Errorf("Expected error containing %q, got %v", tc.expected, err)
+			}
+		})
+	}
+}
+
+func TestProcessTemplateSchema(t *testing.T) {
+	schemaContent := `{
+  "type": "object",
+  "required": ["name"],
+  "additionalProperties": false,
+  "properties": {
+    "name": {"type": "string"},
+    "replicas": {"type": "integer", "default": 1},
+    "image": {
+      "type": "object",
+      "properties": {"tag": {"type": "string"}}
+    }
+  }
+}`
+
+	testCases := []struct {
+		name        string
+		dataFile    string
+		data        string
+		files       map[string]string
+		environment string
+		overrides   []map[string]interface{}
+		expected    string
+		errors      []string
+	}{
+		{
+			name:     "Defaults filled in",
+			dataFile: "data.yaml",
+			data:     "name: web\n",
+			expected: "web 1",
+		},
+		{
+			name:     "Errors with YAML positions",
+			dataFile: "data.yaml",
+			data:     "replcas: 3\nimage:\n  tag: 12\n",
+			errors: []string{
+				`/: missing required property "name" (data.yaml:1:1)`,
+				"/image/tag: expected string, got integer (data.yaml:3:8)",
+				`/replcas: unexpected property "replcas" (did you mean "replicas"?) (data.yaml:1:1)`,
+			},
+		},
+		{
+			name:     "Errors in included files",
+			dataFile: "data.yaml",
+			data:     "name: web\nimage: !include common/image.yaml\n",
+			files:    map[string]string{"common/image.yaml": "# image\ntag: 12\n"},
+			errors:   []string{"/image/tag: expected string, got integer (" + filepath.Join("common", "image.yaml") + ":2:6)"},
+		},
+		{
+			name:     "Errors with JSON positions",
+			dataFile: "data.json",
+			data:     "{\n  \"name\": \"web\",\n  \"replicas\": \"3\"\n}\n",
+			errors:   []string{"/replicas: expected integer, got string (data.json:3:15)"},
+		},
+		{
+			name:        "Errors in merged values without positions",
+			dataFile:    "data.yaml",
+			data:        "name: web\nreplicas: 2\nimage:\n  tag: v1\n",
+			files:       map[string]string{"data.prod.yaml": "image:\n  tag: 12\n"},
+			environment: "prod",
+			overrides:   []map[string]interface{}{{"replicas": "three"}},
+			errors: []string{
+				"/image/tag: expected string, got integer\n",
+				"/replicas: expected integer, got string\n",
+			},
+		},
+		{
+			name:     "Errors without positions",
+			dataFile: "data.toml",
+			data:     "name = 3\n",
+			errors:   []string{"/name: expected string, got integer\n"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			srcDir := t.TempDir()
+			config.Reset()
+			config.OutputDir = t.TempDir()
+			defer config.Reset()
+			writeFiles(t, srcDir, map[string]string{
+				"schema.json":      schemaContent,
+				tc.dataFile:        tc.data,
+				"template.go.tmpl": "{{ .name }} {{ .replicas }}",
+			})
+			writeFiles(t, srcDir, tc.files)
+
+			processor := NewProcessor(false)
+			processor.SetEnvironment(tc.environment)
+			processor.SetOverrides(tc.overrides)
+			err := processor.ProcessTemplate(filepath.Join(srcDir, config.TemplateFile), false)
+			if tc.errors != nil {
+				if err == nil {
+					t.Fatal("Expected a validation error")
+				}
+				for _, expected := range tc.errors {
+					if !strings.Contains(err.Error()+"\n", expected) {
+						t.Errorf("Expected error to contain %q, got %v", expected, err)
+					}
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ProcessTemplate failed: %v", err)
+			}
+
+			content, err := os.ReadFile(filepath.Join(config.OutputDir, config.DefaultPrefix))
+			if err != nil {
+				t.Fatalf("Failed to read output: %v", err)
+			}
+			if strings.TrimSpace(string(content)) != tc.expected {
+				t.Errorf("Expected output %q, got %q", tc.expected, content)
+			}
+		})
+	}
+}
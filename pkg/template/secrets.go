@@ -0,0 +1,210 @@
+package template
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"filippo.io/age"
+	"filippo.io/age/armor"
+	"github.com/Samet-MohamedAmin/gotmpl/pkg/config"
+)
+
+// encryptedTag replaces a node with its decrypted value, as a string
+const encryptedTag = "!encrypted"
+
+// redactedValue replaces decrypted values wherever data, output or errors are printed
+const redactedValue = "<redacted>"
+
+// secretSet holds the values a processor decrypted from !encrypted data, so they can be
+// masked wherever data, output or errors are printed. A nil set records nothing.
+type secretSet struct {
+	sync.Mutex
+	values map[string]bool
+}
+
+// newSecretSet creates an empty set of decrypted values
+func newSecretSet() *secretSet {
+	return &secretSet{values: make(map[string]bool)}
+}
+
+// loadIdentities reads the X25519 identities of the file named by the Identity setting
+func loadIdentities() ([]age.Identity, error) {
+	if config.Identity == "" {
+		return nil, errors.New("no identity file to decrypt values; use --identity or GOTMPL_IDENTITY")
+	}
+	file, err := os.Open(config.Identity)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open identity file: %w", err)
+	}
+	defer file.Close()
+
+	identities, err := age.ParseIdentities(file)
+	if err != nil {
+		return nil, fmt.Errorf("invalid identity file %s: %w", config.Identity, err)
+	}
+	return identities, nil
+}
+
+// EncryptValue encrypts a value for the given age recipients and returns it base64-encoded,
+// ready to be tagged !encrypted. Without recipients, the value is encrypted for the
+// identities of the Identity file, so they can decrypt it again.
+func EncryptValue(value []byte, recipients []string) (string, error) {
+	var parsed []age.Recipient
+	for _, recipient := range recipients {
+		r, err := age.ParseX25519Recipient(recipient)
+		if err != nil {
+			return "", fmt.Errorf("invalid recipient %q: %w", recipient, err)
+		}
+		parsed = append(parsed, r)
+	}
+	if len(parsed) == 0 {
+		identities, err := loadIdentities()
+		if err != nil {
+			return "", err
+		}
+		for _, identity := range identities {
+			if x25519, ok := identity.(*age.X25519Identity); ok {
+				parsed = append(parsed, x25519.Recipient())
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	w, err := age.Encrypt(&buf, parsed...)
+	if err != nil {
+		return "", fmt.Errorf("failed to encrypt value: %w", err)
+	}
+	if _, err := w.Write(value); err != nil {
+		return "", fmt.Errorf("failed to encrypt value: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return "", fmt.Errorf("failed to encrypt value: %w", err)
+	}
+	return base64.StdEncoding.EncodeToString(buf.Bytes()), nil
+}
+
+// DecryptValue decrypts an !encrypted value with the identities of the Identity file. The
+// value is an age file, base64-encoded or ASCII-armored.
+func DecryptValue(value string) (string, error) {
+	identities, err := loadIdentities()
+	if err != nil {
+		return "", err
+	}
+
+	value = strings.TrimSpace(value)
+	var src io.Reader
+	if strings.HasPrefix(value, armor.Header) {
+		src = armor.NewReader(strings.NewReader(value))
+	} else {
+		ciphertext, err := base64.StdEncoding.DecodeString(value)
+		if err != nil {
+			return "", fmt.Errorf("value is neither base64 nor armored: %w", err)
+		}
+		src = bytes.NewReader(ciphertext)
+	}
+
+	r, err := age.Decrypt(src, identities...)
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt value: %w", err)
+	}
+	plaintext, err := io.ReadAll(r)
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt value: %w", err)
+	}
+	return string(plaintext), nil
+}
+
+// add records a decrypted value. Empty values reveal nothing and are not recorded.
+func (s *secretSet) add(value string) {
+	if s == nil || value == "" {
+		return
+	}
+	s.Lock()
+	defer s.Unlock()
+	s.values[value] = true
+}
+
+// mask returns a copy of a decoded value where every string, key or value, that is a
+// decrypted value is replaced with <redacted>. Whole values are compared, so the result
+// can be encoded in any format without leaking them.
+func (s *secretSet) mask(v interface{}) interface{} {
+	if s == nil {
+		return v
+	}
+	s.Lock()
+	defer s.Unlock()
+	return maskValue(v, s.values)
+}
+
+// redact replaces every occurrence of a decrypted value in a text with <redacted>. Longer
+// values are replaced first, so a value holding another one is replaced whole.
+func (s *secretSet) redact(text string) string {
+	if s == nil {
+		return text
+	}
+	s.Lock()
+	secrets := make([]string, 0, len(s.values))
+	for value := range s.values {
+		secrets = append(secrets, value)
+	}
+	s.Unlock()
+
+	sort.Slice(secrets, func(i, j int) bool {
+		if len(secrets[i]) != len(secrets[j]) {
+			return len(secrets[i]) > len(secrets[j])
+		}
+		return secrets[i] < secrets[j]
+	})
+	for _, secret := range secrets {
+		text = strings.ReplaceAll(text, secret, redactedValue)
+	}
+	return text
+}
+
+// redactError returns err unchanged when its message holds no decrypted value, and an
+// error with the values replaced with <redacted> otherwise
+func (s *secretSet) redactError(err error) error {
+	if err == nil {
+		return nil
+	}
+	if message := s.redact(err.Error()); message != err.Error() {
+		return errors.New(message)
+	}
+	return err
+}
+
+// maskValue replaces the secrets below a value
+func maskValue(v interface{}, secrets map[string]bool) interface{} {
+	switch value := v.(type) {
+	case string:
+		if secrets[value] {
+			return redactedValue
+		}
+		return value
+	case map[string]interface{}:
+		result := make(map[string]interface{}, len(value))
+		for _, key := range orderedKeys(value) {
+			masked := key
+			if secrets[key] {
+				masked = redactedValue
+			}
+			setKey(result, masked, maskValue(value[key], secrets))
+		}
+		return result
+	case []interface{}:
+		result := make([]interface{}, len(value))
+		for i, item := range value {
+			result[i] = maskValue(item, secrets)
+		}
+		return result
+	default:
+		return v
+	}
+}
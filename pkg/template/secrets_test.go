@@ -0,0 +1,207 @@
+package template
+
+import (
+	"bytes"
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"filippo.io/age"
+	"filippo.io/age/armor"
+	"github.com/Samet-MohamedAmin/gotmpl/pkg/config"
+)
+
+// writeIdentity writes a new X25519 identity file and returns its path and identity
+func writeIdentity(t *testing.T, dir, name string) (string, *age.X25519Identity) {
+	t.Helper()
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatalf("Failed to generate identity: %v", err)
+	}
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte("# test key\n"+identity.String()+"\n"), 0600); err != nil {
+		t.Fatalf("Failed to write identity: %v", err)
+	}
+	return path, identity
+}
+
+func TestDecodeEncryptedValues(t *testing.T) {
+	dir := t.TempDir()
+	keyPath, identity := writeIdentity(t, dir, "key.txt")
+	otherPath, _ := writeIdentity(t, dir, "other.txt")
+
+	config.Reset()
+	defer config.Reset()
+	config.Identity = keyPath
+
+	encrypted, err := EncryptValue([]byte("s3cr3t-password"), nil)
+	if err != nil {
+		t.Fatalf("EncryptValue failed: %v", err)
+	}
+	forRecipient, err := EncryptValue([]byte("line one\nline two"), []string{identity.Recipient().String()})
+	if err != nil {
+		t.Fatalf("EncryptValue failed: %v", err)
+	}
+
+	ciphertext, _ := base64.StdEncoding.DecodeString(encrypted)
+	var armored bytes.Buffer
+	w := armor.NewWriter(&armored)
+	w.Write(ciphertext)
+	w.Close()
+
+	testCases := []struct {
+		name     string
+		data     string
+		identity string
+		expected map[string]interface{}
+		err      string
+	}{
+		{
+			name:     "Base64 value",
+			data:     "password: !encrypted " + encrypted + "\n",
+			identity: keyPath,
+			expected: map[string]interface{}{"password": "s3cr3t-password"},
+		},
+		{
+			name:     "Armored value",
+			data:     "password: !encrypted |\n  " + strings.ReplaceAll(strings.TrimSpace(armored.String()), "\n", "\n  ") + "\n",
+			identity: keyPath,
+			expected: map[string]interface{}{"password": "s3cr3t-password"},
+		},
+		{
+			name:     "Multi-line value for a recipient",
+			data:     "cert: !encrypted " + forRecipient + "\n",
+			identity: keyPath,
+			expected: map[string]interface{}{"cert": "line one\nline two"},
+		},
+		{name: "No identity", data: "password: !encrypted " + encrypted + "\n", err: "no identity file"},
+		{name: "Wrong identity", data: "password: !encrypted " + encrypted + "\n", identity: otherPath, err: "failed to decrypt value"},
+		{name: "Missing identity file", data: "password: !encrypted " + encrypted + "\n", identity: filepath.Join(dir, "missing.txt"), err: "failed to open identity file"},
+		{name: "Invalid value", data: "password: !encrypted not-base64!\n", identity: keyPath, err: "data.yaml:1:11: !encrypted: value is neither base64 nor armored"},
+	}
+
+	secrets := newSecretSet()
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			config.Identity = tc.identity
+			documents, err := decodeDocuments(filepath.Join(dir, "data.yaml"), []byte(tc.data), "", secrets)
+			if tc.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.err) {
+					t.Errorf("Expected error containing %q, got %v", tc.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Failed to decode data: %v", err)
+			}
+			for key, value := range tc.expected {
+				if got := documents[0].(map[string]interface{})[key]; got != value {
+					t.Errorf("Expected %s to be %q, got %q", key, value, got)
+				}
+			}
+		})
+	}
+
+	if len(secrets.values) != 2 {
+		t.Errorf("Expected 2 decrypted values to be recorded, got %d", len(secrets.values))
+	}
+	masked, err := toYAML(secrets.mask(map[string]interface{}{
+		"password": "s3cr3t-password",
+		"certs":    []interface{}{"line one\nline two"},
+		"user":     "admin",
+		"note":     "line one",
+	}))
+	if err != nil {
+		t.Fatalf("Failed to encode masked data: %v", err)
+	}
+	if strings.Contains(masked, "s3cr3t") || strings.Contains(masked, "line two") {
+		t.Errorf("Expected decrypted values to be masked, got %q", masked)
+	}
+	if !strings.Contains(masked, "user: admin") || !strings.Contains(masked, "note: line one") {
+		t.Errorf("Expected values that weren't decrypted to be kept, got %q", masked)
+	}
+
+	redacted := secrets.redact("password=s3cr3t-password cert=line one\nline two note=line one")
+	if expected := "password=<redacted> cert=<redacted> note=line one"; redacted != expected {
+		t.Errorf("Expected %q, got %q", expected, redacted)
+	}
+}
+
+func TestEncryptedValuesNotPrinted(t *testing.T) {
+	srcDir := t.TempDir()
+	keyPath, _ := writeIdentity(t, t.TempDir(), "key.txt")
+
+	config.Reset()
+	defer config.Reset()
+	config.OutputDir = t.TempDir()
+	config.Identity = keyPath
+
+	encrypted, err := EncryptValue([]byte("hunter2"), nil)
+	if err != nil {
+		t.Fatalf("EncryptValue failed: %v", err)
+	}
+	writeFiles(t, srcDir, map[string]string{
+		"app/template.go.tmpl":    "{{ .user }}:{{ .password }}",
+		"app/data.yaml":           "user: admin\npassword: !encrypted " + encrypted + "\n",
+		"date/template.go.tmpl":   `{{ toDate "2006-01-02" .password }}`,
+		"date/data.yaml":          "password: !encrypted " + encrypted + "\n",
+		"schema/template.go.tmpl": "{{ . }}",
+		"schema/data.yaml":        "!encrypted " + encrypted + ": 1\n",
+		"schema/schema.yaml":      "additionalProperties: false\n",
+		"plain/template.go.tmpl":  "{{ .user }}",
+		"plain/data.yaml":         "user: hunter2\n",
+	})
+
+	var logs bytes.Buffer
+	SetLogOutput(&logs)
+	defer SetLogOutput(os.Stdout)
+
+	processor := NewProcessor(false)
+	defer processor.Close()
+	var buf bytes.Buffer
+	if err := processor.ShowData(&buf, filepath.Join(srcDir, "app", config.TemplateFile), true); err != nil {
+		t.Fatalf("ShowData failed: %v", err)
+	}
+	if strings.Contains(buf.String(), "hunter2") || !strings.Contains(buf.String(), "password: <redacted>") {
+		t.Errorf("Expected the decrypted value to be masked, got %q", buf.String())
+	}
+
+	if err := processor.ProcessTemplate(filepath.Join(srcDir, "app", config.TemplateFile), true); err != nil {
+		t.Fatalf("ProcessTemplate failed: %v", err)
+	}
+	if strings.Contains(logs.String(), "hunter2") {
+		t.Errorf("Expected the decrypted value to be masked in the logs, got %q", logs.String())
+	}
+	for _, expected := range []string{"Template data: map[password:<redacted> user:admin]", "admin:<redacted>"} {
+		if !strings.Contains(logs.String(), expected) {
+			t.Errorf("Expected the logs to contain %q, got %q", expected, logs.String())
+		}
+	}
+	content, err := os.ReadFile(filepath.Join(config.OutputDir, "app", config.DefaultPrefix))
+	if err != nil {
+		t.Fatalf("Failed to read output: %v", err)
+	}
+	if string(content) != "admin:hunter2" {
+		t.Errorf("Expected the output to hold the plaintext, got %q", content)
+	}
+
+	for _, name := range []string{"date", "schema"} {
+		err := processor.ProcessTemplate(filepath.Join(srcDir, name, config.TemplateFile), true)
+		if err == nil || strings.Contains(err.Error(), "hunter2") || !strings.Contains(err.Error(), "<redacted>") {
+			t.Errorf("Expected the %s error to mask the decrypted value, got %v", name, err)
+		}
+	}
+
+	// Secrets are tracked per processor, so one that decrypted nothing prints data as is
+	logs.Reset()
+	plain := NewProcessor(false)
+	defer plain.Close()
+	if err := plain.ProcessTemplate(filepath.Join(srcDir, "plain", config.TemplateFile), true); err != nil {
+		t.Fatalf("ProcessTemplate failed: %v", err)
+	}
+	if !strings.Contains(logs.String(), "Template data: map[user:hunter2]") {
+		t.Errorf("Expected the data of a processor without secrets to be printed, got %q", logs.String())
+	}
+}
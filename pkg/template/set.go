@@ -0,0 +1,111 @@
+package template
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"text/template"
+)
+
+// maxIncludeDepth limits nested include and tpl calls so a template that includes itself
+// fails with an error instead of exhausting the stack
+const maxIncludeDepth = 100
+
+// templateSet is a parsed template together with the partials it was built from.
+// It gives template functions access to the set they belong to; the functions have to be
+// registered before parsing, so the set is filled in afterwards.
+type templateSet struct {
+	parsed *template.Template
+	tmpl   Template
+	depth  int
+	// files maps the name of each parsed file to its path, for error messages
+	files map[string]string
+}
+
+// newTemplateSet creates an empty template set
+func newTemplateSet() *templateSet {
+	return &templateSet{
+		files: make(map[string]string),
+	}
+}
+
+// Execute renders the root template of the set
+func (s *templateSet) Execute(wr io.Writer, data interface{}) error {
+	return s.describeError(s.tmpl.Execute(wr, data))
+}
+
+// ExecuteTemplate renders the named template of the set
+func (s *templateSet) ExecuteTemplate(wr io.Writer, name string, data interface{}) error {
+	return s.describeError(s.tmpl.ExecuteTemplate(wr, name, data))
+}
+
+// funcs returns the functions that render other templates of the set
+func (s *templateSet) funcs() template.FuncMap {
+	return template.FuncMap{
+		"include": s.include,
+		"tpl":     s.tpl,
+	}
+}
+
+// include renders the named template and returns the result as a string, so it can be piped
+// into other functions. With the html engine the string is escaped again where it's inserted,
+// unless the calling template marks it with safeHTML.
+func (s *templateSet) include(name string, data interface{}) (string, error) {
+	if s.tmpl == nil {
+		return "", fmt.Errorf("include %q: template set is not ready", name)
+	}
+	if err := s.enter(); err != nil {
+		return "", fmt.Errorf("include %q: %w", name, err)
+	}
+	defer s.leave()
+
+	var buf strings.Builder
+	if err := s.tmpl.ExecuteTemplate(&buf, name, data); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// tpl parses text as a template and renders it against data. The text is parsed into a copy
+// of the set, so it can use the same functions and partials as the calling template.
+func (s *templateSet) tpl(text string, data interface{}) (string, error) {
+	if s.parsed == nil {
+		return "", fmt.Errorf("tpl: template set is not ready")
+	}
+	if err := s.enter(); err != nil {
+		return "", fmt.Errorf("tpl: %w", err)
+	}
+	defer s.leave()
+
+	clone, err := s.parsed.Clone()
+	if err != nil {
+		return "", fmt.Errorf("tpl: %w", err)
+	}
+	t, err := clone.New("tpl").Parse(text)
+	if err != nil {
+		return "", fmt.Errorf("tpl: %w", err)
+	}
+	if preserveOrder() {
+		orderRanges(clone)
+	}
+
+	var buf strings.Builder
+	if err := t.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("tpl: %w", err)
+	}
+	return buf.String(), nil
+}
+
+// enter records a nested render, failing once the depth limit is reached
+func (s *templateSet) enter() error {
+	if s.depth >= maxIncludeDepth {
+		return fmt.Errorf("exceeded maximum nesting depth of %d", maxIncludeDepth)
+	}
+	s.depth++
+	return nil
+}
+
+// leave undoes enter
+func (s *templateSet) leave() {
+	s.depth--
+}
@@ -0,0 +1,158 @@
+package template
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// commonInitialisms are the words written in all caps by the Go naming functions, following the
+// list used by golint. A word is matched case-insensitively, so "Id", "id" and "ID" all become "ID".
+var commonInitialisms = map[string]bool{
+	"ACL": true, "API": true, "ASCII": true, "CPU": true, "CSS": true, "DNS": true,
+	"EOF": true, "GUID": true, "HTML": true, "HTTP": true, "HTTPS": true, "ID": true,
+	"IP": true, "JSON": true, "LHS": true, "QPS": true, "RAM": true, "RHS": true,
+	"RPC": true, "SLA": true, "SMTP": true, "SQL": true, "SSH": true, "TCP": true,
+	"TLS": true, "TTL": true, "UDP": true, "UI": true, "UID": true, "UUID": true,
+	"URI": true, "URL": true, "UTF8": true, "VM": true, "XML": true, "XMPP": true,
+	"XSRF": true, "XSS": true,
+}
+
+// splitWords splits an identifier into words. Any rune that is neither a letter nor a digit
+// separates words, and a new word starts at a lower-to-upper case change ("userId" -> "user", "Id")
+// or at the last upper case letter of a run followed by a lower case one ("HTTPServer" -> "HTTP", "Server").
+// Digits stay attached to the word before them.
+func splitWords(s string) []string {
+	var words []string
+	var current []rune
+
+	flush := func() {
+		if len(current) > 0 {
+			words = append(words, string(current))
+			current = nil
+		}
+	}
+
+	runes := []rune(s)
+	for i, r := range runes {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			flush()
+			continue
+		}
+
+		if unicode.IsUpper(r) && len(current) > 0 {
+			prev := current[len(current)-1]
+			nextIsLower := i+1 < len(runes) && unicode.IsLower(runes[i+1]) && !pluralInitialism(runes, i)
+			if unicode.IsLower(prev) || unicode.IsDigit(prev) || (unicode.IsUpper(prev) && nextIsLower) {
+				flush()
+			}
+		}
+		current = append(current, r)
+	}
+	flush()
+
+	return words
+}
+
+// pluralInitialism reports whether the upper-case rune at i ends an initialism made plural
+// by a lower-case s, as in "URLs" or "userIDs"
+func pluralInitialism(runes []rune, i int) bool {
+	if i+1 >= len(runes) || runes[i+1] != 's' {
+		return false
+	}
+	return i+2 == len(runes) || !unicode.IsLower(runes[i+2])
+}
+
+// goInitialism returns word in all caps when it is a common initialism, keeping the s of a
+// plural one lower case ("url" -> "URL", "ids" -> "IDs")
+func goInitialism(word string) (string, bool) {
+	upper := strings.ToUpper(word)
+	if commonInitialisms[upper] {
+		return upper, true
+	}
+	if singular, ok := strings.CutSuffix(upper, "S"); ok && commonInitialisms[singular] {
+		return singular + "s", true
+	}
+	return "", false
+}
+
+// capitalize upper-cases the first letter of a word and lower-cases the rest
+func capitalize(word string) string {
+	first, size := utf8.DecodeRuneInString(word)
+	if first == utf8.RuneError {
+		return word
+	}
+	return string(unicode.ToUpper(first)) + strings.ToLower(word[size:])
+}
+
+// joinWords converts every word with convert and joins them with sep
+func joinWords(s, sep string, convert func(i int, word string) string) string {
+	words := splitWords(s)
+	for i, word := range words {
+		words[i] = convert(i, word)
+	}
+	return strings.Join(words, sep)
+}
+
+// camelCase converts s to camelCase
+func camelCase(s string) string {
+	return joinWords(s, "", func(i int, word string) string {
+		if i == 0 {
+			return strings.ToLower(word)
+		}
+		return capitalize(word)
+	})
+}
+
+// pascalCase converts s to PascalCase
+func pascalCase(s string) string {
+	return joinWords(s, "", func(_ int, word string) string {
+		return capitalize(word)
+	})
+}
+
+// snakeCase converts s to snake_case
+func snakeCase(s string) string {
+	return joinWords(s, "_", func(_ int, word string) string {
+		return strings.ToLower(word)
+	})
+}
+
+// kebabCase converts s to kebab-case
+func kebabCase(s string) string {
+	return joinWords(s, "-", func(_ int, word string) string {
+		return strings.ToLower(word)
+	})
+}
+
+// screamingCase converts s to SCREAMING_SNAKE_CASE
+func screamingCase(s string) string {
+	return joinWords(s, "_", func(_ int, word string) string {
+		return strings.ToUpper(word)
+	})
+}
+
+// goPascalCase converts s to an exported Go name, writing common initialisms in all caps
+// ("user_id" -> "UserID", "http_server" -> "HTTPServer", "urls" -> "URLs")
+func goPascalCase(s string) string {
+	return joinWords(s, "", func(_ int, word string) string {
+		if initialism, ok := goInitialism(word); ok {
+			return initialism
+		}
+		return capitalize(word)
+	})
+}
+
+// goCamelCase converts s to an unexported Go name. The first word is all lower case even when it
+// is an initialism; later initialisms are written in all caps ("user_id" -> "userID", "URL" -> "url").
+func goCamelCase(s string) string {
+	return joinWords(s, "", func(i int, word string) string {
+		if i == 0 {
+			return strings.ToLower(word)
+		}
+		if initialism, ok := goInitialism(word); ok {
+			return initialism
+		}
+		return capitalize(word)
+	})
+}
@@ -0,0 +1,69 @@
+package template
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/Samet-MohamedAmin/gotmpl/pkg/config"
+)
+
+// addUserFuncs adds the functions declared in the Functions setting to funcs. Each body is
+// parsed as a template that renders with its argument as dot, or with the list of arguments
+// when there are several. Bodies can call every other function, including each other.
+func (p *TemplateProcessor) addUserFuncs(set *templateSet, funcs template.FuncMap) error {
+	if len(config.Functions) == 0 {
+		return nil
+	}
+
+	names := make([]string, 0, len(config.Functions))
+	for name := range config.Functions {
+		if _, exists := funcs[name]; exists || templateBuiltins[name] {
+			return fmt.Errorf("function %q from Functions is already defined", name)
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	bodies := template.New("Functions").Delims(config.LeftDelim, config.RightDelim)
+	for _, name := range names {
+		funcs[name] = userFunc(set, bodies, name)
+	}
+	bodies.Funcs(funcs).Option(p.templateOptions()...)
+
+	for _, name := range names {
+		if _, err := bodies.New(name).Parse(config.Functions[name]); err != nil {
+			return fmt.Errorf("invalid function %q in Functions: %w", name, err)
+		}
+	}
+	if preserveOrder() {
+		orderRanges(bodies)
+	}
+	return nil
+}
+
+// userFunc returns the template function rendering the body with the given name
+func userFunc(set *templateSet, bodies *template.Template, name string) func(args ...interface{}) (string, error) {
+	return func(args ...interface{}) (string, error) {
+		if err := set.enter(); err != nil {
+			return "", fmt.Errorf("%s: %w", name, err)
+		}
+		defer set.leave()
+
+		var dot interface{}
+		switch len(args) {
+		case 0:
+		case 1:
+			dot = args[0]
+		default:
+			dot = args
+		}
+
+		var buf strings.Builder
+		if err := bodies.ExecuteTemplate(&buf, name, dot); err != nil {
+			return "", err
+		}
+		return buf.String(), nil
+	}
+}
@@ -0,0 +1,273 @@
+package template
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// The flags giving the values layered over the data of every template
+const (
+	ValuesFlag    = "--values"
+	SetFlag       = "--set"
+	SetStringFlag = "--set-string"
+	SetFileFlag   = "--set-file"
+)
+
+// ValueSource is a values file or a list of assignments, with the flag that gave it. Sources
+// are layered in the order they appear on the command line, whatever their flag.
+type ValueSource struct {
+	Flag  string
+	Value string
+}
+
+// LoadValues reads the values files and parses the assignments into the layers merged over
+// the data of every template
+func (p *TemplateProcessor) LoadValues(sources []ValueSource) error {
+	layers, err := loadValueLayers(sources, p.secrets)
+	if err != nil {
+		return err
+	}
+	p.overrides = layers
+	return nil
+}
+
+// loadValueLayers reads the values files and parses the assignments into layers, one layer
+// per source and in the same order. Each layer is merged with mergeValues. The values
+// decrypted from values files are recorded in secrets.
+func loadValueLayers(sources []ValueSource, secrets *secretSet) ([]map[string]interface{}, error) {
+	var layers []map[string]interface{}
+
+	for _, source := range sources {
+		var value func(string) (interface{}, error)
+		switch source.Flag {
+		case ValuesFlag:
+			layer, err := loadValuesFile(source.Value, secrets)
+			if err != nil {
+				return nil, err
+			}
+			layers = append(layers, layer)
+			continue
+		case SetFlag:
+			value = func(s string) (interface{}, error) { return typedValue(s), nil }
+		case SetStringFlag:
+			value = func(s string) (interface{}, error) { return s, nil }
+		case SetFileFlag:
+			value = readValueFile
+		default:
+			return nil, fmt.Errorf("unknown values flag %s", source.Flag)
+		}
+
+		layer := make(map[string]interface{})
+		if err := parseAssignments(layer, source.Value, value); err != nil {
+			return nil, fmt.Errorf("invalid %s %q: %w", source.Flag, source.Value, err)
+		}
+		layers = append(layers, layer)
+	}
+
+	return layers, nil
+}
+
+// loadValuesFile reads a values file in any supported data format. It must be a mapping.
+func loadValuesFile(path string, secrets *secretSet) (map[string]interface{}, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read values file: %w", err)
+	}
+	documents, err := decodeDocuments(path, content, "", secrets)
+	if err != nil {
+		return nil, fmt.Errorf("values file %s: %w", path, err)
+	}
+	if len(documents) > 1 {
+		return nil, fmt.Errorf("values file %s has %d documents, expected one", path, len(documents))
+	}
+
+	switch values := documents[0].(type) {
+	case nil:
+		return map[string]interface{}{}, nil
+	case map[string]interface{}:
+		return values, nil
+	default:
+		return nil, fmt.Errorf("values file %s is not a mapping", path)
+	}
+}
+
+// readValueFile returns the content of the file named by a --set-file value
+func readValueFile(path string) (interface{}, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return string(content), nil
+}
+
+// parseAssignments parses comma-separated key.path=value assignments into layer. A comma,
+// dot or equals sign that is part of a key or value is escaped with a backslash, and
+// "{a,b}" sets a list.
+func parseAssignments(layer map[string]interface{}, assignments string, value func(string) (interface{}, error)) error {
+	for _, assignment := range splitEscaped(assignments, ',', true) {
+		key, raw, ok := cutEscaped(assignment, '=')
+		if !ok {
+			return fmt.Errorf("expected key=value, got %q", assignment)
+		}
+
+		path := splitEscaped(key, '.', false)
+		for i, part := range path {
+			path[i] = unescape(part)
+			if path[i] == "" {
+				return fmt.Errorf("empty key in %q", key)
+			}
+		}
+
+		var v interface{}
+		if strings.HasPrefix(raw, "{") && strings.HasSuffix(raw, "}") {
+			var list []interface{}
+			for _, item := range splitEscaped(raw[1:len(raw)-1], ',', false) {
+				itemValue, err := value(unescape(item))
+				if err != nil {
+					return err
+				}
+				list = append(list, itemValue)
+			}
+			v = list
+		} else {
+			var err error
+			if v, err = value(unescape(raw)); err != nil {
+				return err
+			}
+		}
+
+		setPath(layer, path, v)
+	}
+	return nil
+}
+
+// splitEscaped splits s around unescaped separators. When skipBraces is set, separators
+// inside {...} lists are kept, so "a={1,2},b=3" splits into two assignments.
+func splitEscaped(s string, sep byte, skipBraces bool) []string {
+	var parts []string
+	depth := 0
+	start := 0
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] == '\\':
+			i++
+		case skipBraces && s[i] == '{':
+			depth++
+		case skipBraces && s[i] == '}' && depth > 0:
+			depth--
+		case s[i] == sep && depth == 0:
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, s[start:])
+}
+
+// cutEscaped is like strings.Cut but ignores escaped separators
+func cutEscaped(s string, sep byte) (string, string, bool) {
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case sep:
+			return s[:i], s[i+1:], true
+		}
+	}
+	return s, "", false
+}
+
+// unescape removes the backslashes escaping separators
+func unescape(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) {
+			i++
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+// typedValue converts a --set value: true, false, null and integers are typed, anything
+// else is a string
+func typedValue(s string) interface{} {
+	switch s {
+	case "true":
+		return true
+	case "false":
+		return false
+	case "null":
+		return nil
+	}
+	if n, err := strconv.Atoi(s); err == nil && strconv.Itoa(n) == s {
+		return n
+	}
+	return s
+}
+
+// setPath sets the value at a path of keys, creating or replacing intermediate maps
+func setPath(root map[string]interface{}, path []string, value interface{}) {
+	current := root
+	for _, key := range path[:len(path)-1] {
+		next, ok := current[key].(map[string]interface{})
+		if !ok {
+			next = make(map[string]interface{})
+			setKey(current, key, next)
+		}
+		current = next
+	}
+	setKey(current, path[len(path)-1], value)
+}
+
+// mergeValues deep-merges src into dst in place: maps are merged key by key, any other
+// value, lists included, replaces the value in dst, and a null value deletes the key. Keys
+// new to dst are added in the order of src.
+func mergeValues(dst, src map[string]interface{}) {
+	for _, key := range orderedKeys(src) {
+		srcValue := src[key]
+		if srcValue == nil {
+			delete(dst, key)
+			continue
+		}
+
+		srcMap, ok := srcValue.(map[string]interface{})
+		if !ok {
+			setKey(dst, key, copyValue(srcValue))
+			continue
+		}
+		dstMap, ok := dst[key].(map[string]interface{})
+		if !ok {
+			dstMap = make(map[string]interface{})
+			setKey(dst, key, dstMap)
+		}
+		mergeValues(dstMap, srcMap)
+	}
+}
+
+// applyOverrides merges the value layers over template data
+func (p *TemplateProcessor) applyOverrides(data interface{}) (interface{}, error) {
+	if len(p.overrides) == 0 {
+		return data, nil
+	}
+	return mergeLayers(data, p.overrides...)
+}
+
+// mergeLayers merges layers in order over data, which must be a mapping or empty
+func mergeLayers(data interface{}, layers ...map[string]interface{}) (interface{}, error) {
+	if data == nil {
+		data = make(map[string]interface{})
+	}
+	root, ok := data.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("data is not a mapping, so values can't be merged into it")
+	}
+	for _, layer := range layers {
+		mergeValues(root, layer)
+	}
+	return root, nil
+}
@@ -0,0 +1,191 @@
+package template
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/Samet-MohamedAmin/gotmpl/pkg/config"
+)
+
+func TestMergeValues(t *testing.T) {
+	dst := map[string]interface{}{
+		"image":    map[string]interface{}{"repository": "nginx", "tag": "1.25"},
+		"ports":    []interface{}{80, 443},
+		"debug":    true,
+		"replicas": 1,
+	}
+	src := map[string]interface{}{
+		"image":    map[string]interface{}{"tag": "1.27"},
+		"ports":    []interface{}{8080},
+		"debug":    nil,
+		"missing":  nil,
+		"env":      map[string]interface{}{"LEVEL": "info", "UNSET": nil},
+		"replicas": 3,
+	}
+
+	mergeValues(dst, src)
+
+	expected := map[string]interface{}{
+		"image":    map[string]interface{}{"repository": "nginx", "tag": "1.27"},
+		"ports":    []interface{}{8080},
+		"env":      map[string]interface{}{"LEVEL": "info"},
+		"replicas": 3,
+	}
+	if !reflect.DeepEqual(dst, expected) {
+		t.Errorf("Expected %v, got %v", expected, dst)
+	}
+
+	// The merged list must not share its backing array with the source
+	dst["ports"].([]interface{})[0] = 1
+	if src["ports"].([]interface{})[0] != 8080 {
+		t.Error("Expected mergeValues to copy lists from the source")
+	}
+}
+
+func TestLoadValueLayers(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"base.yaml": "image:\n  repository: nginx\n  tag: \"1.25\"\nreplicas: 1\n",
+		"prod.json": `{"replicas": 5, "image": {"tag": "1.26"}}`,
+		"motd.txt":  "Welcome\n",
+		"list.yaml": "- a\n",
+	})
+
+	testCases := []struct {
+		name     string
+		sources  []ValueSource
+		expected map[string]interface{}
+		errorMsg string
+	}{
+		{
+			name:    "Values files in order",
+			sources: []ValueSource{{ValuesFlag, filepath.Join(dir, "base.yaml")}, {ValuesFlag, filepath.Join(dir, "prod.json")}},
+			expected: map[string]interface{}{
+				"image":    map[string]interface{}{"repository": "nginx", "tag": "1.26"},
+				"replicas": 5,
+				"removed":  "yes",
+			},
+		},
+		{
+			name:    "Typed set values",
+			sources: []ValueSource{{SetFlag, "image.tag=1.2.3,replicas=3"}, {SetFlag, "debug=true"}, {SetFlag, "removed=null"}},
+			expected: map[string]interface{}{
+				"image":    map[string]interface{}{"tag": "1.2.3"},
+				"replicas": 3,
+				"debug":    true,
+			},
+		},
+		{
+			name:    "Lists and escapes",
+			sources: []ValueSource{{SetFlag, `hosts={a.example.com,b.example.com},annotations.app\.kubernetes\.io/name=web,note=a\,b`}},
+			expected: map[string]interface{}{
+				"hosts":       []interface{}{"a.example.com", "b.example.com"},
+				"annotations": map[string]interface{}{"app.kubernetes.io/name": "web"},
+				"note":        "a,b",
+				"removed":     "yes",
+			},
+		},
+		{
+			name: "String and file values",
+			sources: []ValueSource{
+				{SetStringFlag, "replicas=3"},
+				{SetStringFlag, "enabled=true"},
+				{SetFileFlag, "motd=" + filepath.Join(dir, "motd.txt")},
+			},
+			expected: map[string]interface{}{
+				"replicas": "3",
+				"enabled":  "true",
+				"motd":     "Welcome\n",
+				"removed":  "yes",
+			},
+		},
+		{
+			name: "Command line order across flags",
+			sources: []ValueSource{
+				{SetFlag, "replicas=2,image.tag=1.0"},
+				{ValuesFlag, filepath.Join(dir, "prod.json")},
+				{SetStringFlag, "replicas=7"},
+				{SetFlag, "image.tag=2.0"},
+			},
+			expected: map[string]interface{}{
+				"image":    map[string]interface{}{"tag": "2.0"},
+				"replicas": "7",
+				"removed":  "yes",
+			},
+		},
+		{
+			name:     "Assignment without value",
+			sources:  []ValueSource{{SetFlag, "replicas"}},
+			errorMsg: `invalid --set "replicas"`,
+		},
+		{
+			name:     "Values file that is not a mapping",
+			sources:  []ValueSource{{ValuesFlag, filepath.Join(dir, "list.yaml")}},
+			errorMsg: "is not a mapping",
+		},
+		{
+			name:     "Missing file for set-file",
+			sources:  []ValueSource{{SetFileFlag, "motd=" + filepath.Join(dir, "missing.txt")}},
+			errorMsg: "invalid --set-file",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			layers, err := loadValueLayers(tc.sources, nil)
+			if tc.errorMsg != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.errorMsg) {
+					t.Errorf("Expected error containing %q, got %v", tc.errorMsg, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("loadValueLayers failed: %v", err)
+			}
+
+			merged := map[string]interface{}{"removed": "yes"}
+			for _, layer := range layers {
+				mergeValues(merged, layer)
+			}
+			if !reflect.DeepEqual(merged, tc.expected) {
+				t.Errorf("Expected %v, got %v", tc.expected, merged)
+			}
+		})
+	}
+}
+
+func TestProcessTemplateOverrides(t *testing.T) {
+	srcDir := t.TempDir()
+	config.Reset()
+	config.OutputDir = t.TempDir()
+	defer config.Reset()
+
+	writeFiles(t, srcDir, map[string]string{
+		"app/data.yaml":        "image:\n  repository: nginx\n  tag: \"1.25\"\nreplicas: 1\ndebug: true\n",
+		"app/template.go.tmpl": "{{ .image.repository }}:{{ .image.tag }} x{{ .replicas }} debug={{ .debug | default false }}",
+		"prod.yaml":            "replicas: 3\ndebug: null\n",
+	})
+
+	processor := NewProcessor(false)
+	if err := processor.LoadValues([]ValueSource{
+		{ValuesFlag, filepath.Join(srcDir, "prod.yaml")},
+		{SetFlag, "image.tag=1.27"},
+	}); err != nil {
+		t.Fatalf("LoadValues failed: %v", err)
+	}
+	if err := processor.ProcessTemplate(filepath.Join(srcDir, "app", config.TemplateFile), false); err != nil {
+		t.Fatalf("ProcessTemplate failed: %v", err)
+	}
+
+	content, err := os.ReadFile(filepath.Join(config.OutputDir, config.DefaultPrefix))
+	if err != nil {
+		t.Fatalf("Failed to read output: %v", err)
+	}
+	expected := "nginx:1.27 x3 debug=false"
+	if strings.TrimSpace(string(content)) != expected {
+		t.Errorf("Expected output %q, got %q", expected, content)
+	}
+}
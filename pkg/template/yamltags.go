@@ -0,0 +1,382 @@
+package template
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Custom tags of YAML data files
+const (
+	// includeTag replaces a node with the content of another data file
+	includeTag = "!include"
+	// envTag replaces a node with the value of an allowed environment variable
+	envTag = "!env"
+	// fileTag replaces a node with the content of a file, as a string
+	fileTag = "!file"
+	// refTag replaces a node with a copy of another node of the same document
+	refTag = "!ref"
+)
+
+// yamlTags resolves the !include, !env, !file and !encrypted tags of a YAML data file. Paths are relative
+// to the file and can't point outside the sandbox root.
+type yamlTags struct {
+	path    string
+	sandbox *fileSandbox
+	// chain lists the files being included, from the data file down to this one
+	chain []string
+	// files records the file of the included nodes, shared with the included files
+	files nodeFiles
+	// secrets records the values decrypted from !encrypted nodes
+	secrets *secretSet
+}
+
+// nodeFiles holds the file each node spliced in by !include comes from, as the nodes keep
+// the lines and columns of that file. Nodes of the data file itself are not listed.
+type nodeFiles map[*yaml.Node]string
+
+// file returns the file a node comes from, or fallback when it isn't listed
+func (f nodeFiles) file(node *yaml.Node, fallback string) string {
+	if path, ok := f[node]; ok {
+		return path
+	}
+	return fallback
+}
+
+// mark records path as the file of node and of the nodes below it that aren't listed yet,
+// which come from files included deeper
+func (f nodeFiles) mark(node *yaml.Node, path string) {
+	if _, ok := f[node]; ok {
+		return
+	}
+	f[node] = path
+	for _, child := range node.Content {
+		f.mark(child, path)
+	}
+}
+
+// copied lists the nodes of a copy made by copyNode under the file of the nodes they copy
+func (f nodeFiles) copied(original, copy *yaml.Node) {
+	if path, ok := f[original]; ok {
+		f[copy] = path
+	}
+	for i := range original.Content {
+		f.copied(original.Content[i], copy.Content[i])
+	}
+}
+
+// newYAMLTags creates the tag resolver of a data file. Paths may point anywhere inside root,
+// or inside the file's own directory when root is empty. Decrypted values are recorded in
+// secrets.
+func newYAMLTags(path, root string, secrets *secretSet) (*yamlTags, error) {
+	if root == "" {
+		root = filepath.Dir(path)
+	}
+	sandbox, err := newFileSandbox(root, filepath.Dir(path))
+	if err != nil {
+		return nil, err
+	}
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get absolute path for data file: %w", err)
+	}
+	return &yamlTags{path: path, sandbox: sandbox, chain: []string{absPath}, files: nodeFiles{}, secrets: secrets}, nil
+}
+
+// parseDataNodes parses every document of a YAML data file into nodes and resolves their
+// custom tags. An empty stream is an error, as there is no data to render. The file of the
+// nodes included from other files is returned with them.
+func parseDataNodes(path string, content []byte, root string, secrets *secretSet) ([]*yaml.Node, nodeFiles, error) {
+	tags, err := newYAMLTags(path, root, secrets)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	nodes, err := parseYAMLNodes(content)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(nodes) == 0 {
+		return nil, nil, fmt.Errorf("failed to decode YAML data: %w", io.EOF)
+	}
+
+	for _, node := range nodes {
+		if err := tags.resolve(node); err != nil {
+			return nil, nil, err
+		}
+		if err := resolveRefs(path, node, tags.files); err != nil {
+			return nil, nil, err
+		}
+	}
+	return nodes, tags.files, nil
+}
+
+// decodeNodes decodes parsed YAML documents, recording the key order of their maps
+func decodeNodes(nodes []*yaml.Node) ([]interface{}, error) {
+	documents := make([]interface{}, len(nodes))
+	for i, node := range nodes {
+		if err := node.Decode(&documents[i]); err != nil {
+			return nil, fmt.Errorf("failed to decode YAML data: %w", err)
+		}
+		recordOrder(node, documents[i])
+	}
+	return documents, nil
+}
+
+// parseYAMLNodes parses every document of a YAML stream into nodes. An empty stream has
+// no documents.
+func parseYAMLNodes(content []byte) ([]*yaml.Node, error) {
+	decoder := yaml.NewDecoder(bytes.NewReader(content))
+
+	var nodes []*yaml.Node
+	for {
+		node := &yaml.Node{}
+		err := decoder.Decode(node)
+		if err == io.EOF {
+			return nodes, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode YAML data: %w", err)
+		}
+		nodes = append(nodes, node)
+	}
+}
+
+// resolve replaces the !include, !env, !file and !encrypted nodes below node with their values
+func (t *yamlTags) resolve(node *yaml.Node) error {
+	switch node.Tag {
+	case includeTag, envTag, fileTag, encryptedTag:
+		if node.Kind != yaml.ScalarNode {
+			return t.errorf(node, "%s expects a scalar value", node.Tag)
+		}
+	}
+
+	switch node.Tag {
+	case includeTag:
+		return t.include(node)
+	case envTag:
+		value, err := envValue(node.Value)
+		if err != nil {
+			return t.errorf(node, "%s: %w", envTag, err)
+		}
+		setString(node, value)
+		return nil
+	case fileTag:
+		path, err := t.sandbox.resolve(node.Value)
+		if err != nil {
+			return t.errorf(node, "%s: %w", fileTag, err)
+		}
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return t.errorf(node, "%s: %w", fileTag, err)
+		}
+		setString(node, string(content))
+		return nil
+	case encryptedTag:
+		value, err := DecryptValue(node.Value)
+		if err != nil {
+			return t.errorf(node, "%s: %w", encryptedTag, err)
+		}
+		t.secrets.add(value)
+		setString(node, value)
+		return nil
+	}
+
+	for _, child := range node.Content {
+		if err := t.resolve(child); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// include replaces node with the content of the data file it names. YAML files are included
+// as nodes, with their own tags resolved relative to them; other formats are decoded first.
+func (t *yamlTags) include(node *yaml.Node) error {
+	path, err := t.sandbox.resolve(node.Value)
+	if err != nil {
+		return t.errorf(node, "%s: %w", includeTag, err)
+	}
+	for i, included := range t.chain {
+		if included == path {
+			cycle := append(append([]string(nil), t.chain[i:]...), path)
+			return t.errorf(node, "include cycle: %s", strings.Join(cycle, " -> "))
+		}
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return t.errorf(node, "%s: %w", includeTag, err)
+	}
+
+	var included *yaml.Node
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json", ".toml", ".csv", ".env":
+		documents, err := decodeDocuments(path, content, t.sandbox.root, t.secrets)
+		if err != nil {
+			return t.errorf(node, "%s %s: %w", includeTag, node.Value, err)
+		}
+		if included, err = orderedNode(documents[0]); err != nil {
+			return t.errorf(node, "%s %s: %w", includeTag, node.Value, err)
+		}
+	default:
+		nodes, err := parseYAMLNodes(content)
+		if err != nil {
+			return t.errorf(node, "%s %s: %w", includeTag, node.Value, err)
+		}
+		if len(nodes) > 1 {
+			return t.errorf(node, "%s %s: has %d documents, expected one", includeTag, node.Value, len(nodes))
+		}
+
+		sandbox, err := newFileSandbox(t.sandbox.root, filepath.Dir(path))
+		if err != nil {
+			return err
+		}
+		child := &yamlTags{path: path, sandbox: sandbox, chain: append(append([]string(nil), t.chain...), path), files: t.files, secrets: t.secrets}
+		for _, document := range nodes {
+			if err := child.resolve(document); err != nil {
+				return err
+			}
+		}
+		included = &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!null", Value: "null"}
+		if len(nodes) == 1 && len(nodes[0].Content) > 0 {
+			included = nodes[0].Content[0]
+		}
+	}
+
+	*node = *included
+	t.files.mark(node, path)
+	return nil
+}
+
+// errorf returns an error located at a node of the file
+func (t *yamlTags) errorf(node *yaml.Node, format string, args ...interface{}) error {
+	return fmt.Errorf("%s:%d:%d: %w", t.path, node.Line, node.Column, fmt.Errorf(format, args...))
+}
+
+// setString turns a tagged node into a plain string
+func setString(node *yaml.Node, value string) {
+	*node = yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: value, Line: node.Line, Column: node.Column}
+}
+
+// refResolver resolves the !ref nodes of a document. References are paths of keys and list
+// indexes from the document root, such as ".image.repo" or ".ports.0".
+type refResolver struct {
+	path  string
+	files nodeFiles
+	root  *yaml.Node
+	// active lists the references being resolved, to detect cycles
+	active []*yaml.Node
+}
+
+// resolveRefs replaces the !ref nodes of a document with copies of the nodes they point to.
+// Errors point at the file each !ref node comes from.
+func resolveRefs(path string, document *yaml.Node, files nodeFiles) error {
+	r := &refResolver{path: path, files: files, root: document}
+	return r.resolve(document)
+}
+
+// resolve resolves the references below node
+func (r *refResolver) resolve(node *yaml.Node) error {
+	if node.Tag == refTag {
+		return r.resolveRef(node)
+	}
+	for _, child := range node.Content {
+		if err := r.resolve(child); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// resolveRef replaces a !ref node with a copy of its resolved target
+func (r *refResolver) resolveRef(node *yaml.Node) error {
+	path := r.files.file(node, r.path)
+	if node.Kind != yaml.ScalarNode {
+		return fmt.Errorf("%s:%d:%d: %s expects a path", path, node.Line, node.Column, refTag)
+	}
+	for i, active := range r.active {
+		if active == node {
+			var cycle []string
+			for _, ref := range r.active[i:] {
+				cycle = append(cycle, ref.Value)
+			}
+			cycle = append(cycle, node.Value)
+			return fmt.Errorf("%s:%d:%d: reference cycle: %s", path, node.Line, node.Column, strings.Join(cycle, " -> "))
+		}
+	}
+
+	target, err := lookupNode(r.root, node.Value)
+	if err != nil {
+		return fmt.Errorf("%s:%d:%d: %s %s: %w", path, node.Line, node.Column, refTag, node.Value, err)
+	}
+
+	r.active = append(r.active, node)
+	err = r.resolve(target)
+	r.active = r.active[:len(r.active)-1]
+	if err != nil {
+		return err
+	}
+
+	line, column := node.Line, node.Column
+	copied := copyNode(target)
+	r.files.copied(target, copied)
+	*node = *copied
+	node.Line, node.Column = line, column
+	return nil
+}
+
+// lookupNode returns the node at a dotted path of keys and list indexes
+func lookupNode(document *yaml.Node, path string) (*yaml.Node, error) {
+	node := document
+	if node.Kind == yaml.DocumentNode && len(node.Content) > 0 {
+		node = node.Content[0]
+	}
+
+	path = strings.TrimPrefix(path, ".")
+	if path == "" {
+		return node, nil
+	}
+	for _, key := range strings.Split(path, ".") {
+		for node.Kind == yaml.AliasNode {
+			node = node.Alias
+		}
+
+		var next *yaml.Node
+		switch node.Kind {
+		case yaml.MappingNode:
+			for i := 0; i+1 < len(node.Content); i += 2 {
+				if node.Content[i].Value == key {
+					next = node.Content[i+1]
+				}
+			}
+		case yaml.SequenceNode:
+			if i, err := strconv.Atoi(key); err == nil && i >= 0 && i < len(node.Content) {
+				next = node.Content[i]
+			}
+		}
+		if next == nil {
+			return nil, fmt.Errorf("key %q not found", key)
+		}
+		node = next
+	}
+	return node, nil
+}
+
+// copyNode returns a deep copy of a node. Aliases keep pointing to their anchors.
+func copyNode(node *yaml.Node) *yaml.Node {
+	copied := *node
+	if node.Content != nil {
+		copied.Content = make([]*yaml.Node, len(node.Content))
+		for i, child := range node.Content {
+			copied.Content[i] = copyNode(child)
+		}
+	}
+	return &copied
+}
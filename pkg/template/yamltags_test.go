@@ -0,0 +1,160 @@
+package template
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/Samet-MohamedAmin/gotmpl/pkg/config"
+)
+
+func TestDecodeYAMLTags(t *testing.T) {
+	root := t.TempDir()
+	writeFiles(t, root, map[string]string{
+		"common/labels.yaml":  "team: core\nregistry: !env GOTMPL_TEST_REGISTRY\nowner: !include owner.yaml\n",
+		"common/owner.yaml":   "name: ops\n",
+		"common/limits.json":  `{"cpu": 2, "memory": "1Gi"}`,
+		"common/ports.csv":    "name,port\nhttp,80\n",
+		"common/multi.yaml":   "a: 1\n---\na: 2\n",
+		"common/cycle-a.yaml": "b: !include cycle-b.yaml\n",
+		"common/cycle-b.yaml": "a: !include cycle-a.yaml\n",
+		"common/empty.yaml":   "",
+		"common/bad-ref.yaml": "name: web\nimage: !ref .missing\n",
+		"app/ca.pem":          "-----BEGIN CERTIFICATE-----\n",
+		"outside.txt":         "secret\n",
+	})
+	t.Setenv("GOTMPL_TEST_REGISTRY", "registry.acme.io")
+	t.Setenv("GOTMPL_SECRET", "hunter2")
+
+	config.Reset()
+	config.EnvAllowlist = []string{"GOTMPL_TEST_*"}
+	defer config.Reset()
+
+	testCases := []struct {
+		name     string
+		data     string
+		root     string
+		expected interface{}
+		err      string
+	}{
+		{
+			name: "Include YAML with nested tags",
+			data: "labels: !include ../common/labels.yaml\n",
+			expected: map[string]interface{}{"labels": map[string]interface{}{
+				"team": "core", "registry": "registry.acme.io", "owner": map[string]interface{}{"name": "ops"},
+			}},
+		},
+		{
+			name: "Include other formats",
+			data: "limits: !include ../common/limits.json\nports: !include ../common/ports.csv\n",
+			expected: map[string]interface{}{
+				"limits": map[string]interface{}{"cpu": 2, "memory": "1Gi"},
+				"ports":  []interface{}{map[string]interface{}{"name": "http", "port": "80"}},
+			},
+		},
+		{
+			name:     "Include empty file",
+			data:     "nothing: !include ../common/empty.yaml\n",
+			expected: map[string]interface{}{"nothing": nil},
+		},
+		{
+			name:     "File content",
+			data:     "ca: !file ca.pem\n",
+			expected: map[string]interface{}{"ca": "-----BEGIN CERTIFICATE-----\n"},
+		},
+		{
+			name: "References",
+			data: "image:\n  repo: nginx\n  tag: \"1.27\"\nports: [80, 443]\n" +
+				"sidecar:\n  image: !ref .image\n  port: !ref .ports.1\nalias: !ref .sidecar.image.repo\n",
+			expected: map[string]interface{}{
+				"image":   map[string]interface{}{"repo": "nginx", "tag": "1.27"},
+				"ports":   []interface{}{80, 443},
+				"sidecar": map[string]interface{}{"image": map[string]interface{}{"repo": "nginx", "tag": "1.27"}, "port": 443},
+				"alias":   "nginx",
+			},
+		},
+		{
+			name: "Include cycle",
+			data: "a: !include ../common/cycle-a.yaml\n",
+			err:  "include cycle: " + filepath.Join(root, "common/cycle-a.yaml") + " -> " + filepath.Join(root, "common/cycle-b.yaml") + " -> " + filepath.Join(root, "common/cycle-a.yaml"),
+		},
+		{
+			name: "Reference cycle",
+			data: "a: !ref .b\nb: !ref .c\nc: !ref .a\n",
+			err:  "reference cycle: .b -> .c -> .a -> .b",
+		},
+		{
+			name: "Reference to an ancestor",
+			data: "a:\n  b: !ref .a\n",
+			err:  "reference cycle: .a -> .a",
+		},
+		{name: "Missing reference", data: "a: !ref .image.repo\n", err: `data.yaml:1:4: !ref .image.repo: key "image" not found`},
+		{
+			name: "Missing reference in an included file",
+			data: "app: !include ../common/bad-ref.yaml\n",
+			err:  filepath.Join(root, "common/bad-ref.yaml") + `:2:8: !ref .missing: key "missing" not found`,
+		},
+		{name: "Environment variable not allowed", data: "a: !env GOTMPL_SECRET\n", err: "not allowed by EnvAllowlist"},
+		{name: "File outside the sandbox", data: "a: !file ../outside.txt\n", root: "app", err: "outside the source root"},
+		{name: "Multiple documents included", data: "a: !include ../common/multi.yaml\n", err: "has 2 documents, expected one"},
+		{name: "Tag on a mapping", data: "a: !include {path: x}\n", err: "!include expects a scalar value"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			sandboxRoot := root
+			if tc.root != "" {
+				sandboxRoot = filepath.Join(root, tc.root)
+			}
+
+			dataPath := filepath.Join(root, "app", "data.yaml")
+			if err := os.WriteFile(dataPath, []byte(tc.data), 0644); err != nil {
+				t.Fatalf("Failed to write data: %v", err)
+			}
+			processor := NewProcessor(false)
+			processor.SetSourceRoot(sandboxRoot)
+			documents, err := processor.loadDocuments(dataPath)
+			if tc.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.err) {
+					t.Errorf("Expected error containing %q, got %v", tc.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Failed to decode data: %v", err)
+			}
+			if !reflect.DeepEqual(documents[0], tc.expected) {
+				t.Errorf("Expected %v, got %v", tc.expected, documents[0])
+			}
+		})
+	}
+}
+
+func TestProcessTemplateYAMLTags(t *testing.T) {
+	srcDir := t.TempDir()
+	config.Reset()
+	config.OutputDir = t.TempDir()
+	defer config.Reset()
+
+	writeFiles(t, srcDir, map[string]string{
+		"common/labels.yaml":   "team: core\n",
+		"app/data.yaml":        "labels: !include ../common/labels.yaml\nname: app\ntitle: !ref .name\n",
+		"app/template.go.tmpl": "{{ .title }} {{ .labels.team }}",
+	})
+
+	processor := NewProcessor(false)
+	processor.SetSourceRoot(srcDir)
+	if err := processor.ProcessTemplate(filepath.Join(srcDir, "app", config.TemplateFile), true); err != nil {
+		t.Fatalf("ProcessTemplate failed: %v", err)
+	}
+
+	content, err := os.ReadFile(filepath.Join(config.OutputDir, "app", config.DefaultPrefix))
+	if err != nil {
+		t.Fatalf("Failed to read output: %v", err)
+	}
+	if strings.TrimSpace(string(content)) != "app core" {
+		t.Errorf("Expected output %q, got %q", "app core", content)
+	}
+}